@@ -10,8 +10,7 @@ func archiveFormat(arcFileObj *interface{}, password string, overwriteExisting b
 		mkdirAll               = true
 		implicitTopLevelFolder = false
 		continueOnError        = false
-		compressionLevel       = 9
-		selectiveCompression   = false
+		compressionLevel       = DefaultCompressionLevel
 	)
 
 	tarObj := &archiver.Tar{
@@ -82,7 +81,6 @@ func archiveFormat(arcFileObj *interface{}, password string, overwriteExisting b
 		arcValues.CompressionLevel = compressionLevel
 		arcValues.OverwriteExisting = overwriteExisting
 		arcValues.MkdirAll = mkdirAll
-		arcValues.SelectiveCompression = selectiveCompression
 		arcValues.ImplicitTopLevelFolder = implicitTopLevelFolder
 		arcValues.ContinueOnError = continueOnError
 
@@ -123,3 +121,35 @@ func archiveFormat(arcFileObj *interface{}, password string, overwriteExisting b
 
 	return nil
 }
+
+// returns the archiver object of the tarball [format]; it is only used to pick the compressor
+func (format ArchiveFormat) tarballFormat() (interface{}, error) {
+	switch format {
+	case FormatTar:
+		return &archiver.Tar{}, nil
+
+	case FormatTarGz:
+		return &archiver.TarGz{}, nil
+
+	case FormatTarBz2:
+		return &archiver.TarBz2{}, nil
+
+	case FormatTarBrotli:
+		return &archiver.TarBrotli{}, nil
+
+	case FormatTarLz4:
+		return &archiver.TarLz4{}, nil
+
+	case FormatTarSz:
+		return &archiver.TarSz{}, nil
+
+	case FormatTarXz:
+		return &archiver.TarXz{}, nil
+
+	case FormatTarZstd:
+		return &archiver.TarZstd{}, nil
+
+	default:
+		return nil, fmt.Errorf("archive file format is not supported: %s", format)
+	}
+}
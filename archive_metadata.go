@@ -0,0 +1,31 @@
+package onearchiver
+
+import (
+	"github.com/yeka/zip"
+	"path/filepath"
+)
+
+// returns the archive level details, such as the comment of a zip file
+// the formats without any such details return an empty [ArchiveMetadata]
+func GetArchiveMetadata(meta *ArchiveMeta) (ArchiveMetadata, error) {
+	_meta := *meta
+
+	source, err := openArchiveSource(&_meta)
+	if err != nil {
+		return ArchiveMetadata{}, err
+	}
+
+	defer source.close()
+
+	if filepath.Ext(_meta.Filename) != ".zip" {
+		return ArchiveMetadata{}, nil
+	}
+
+	// the comment of an encrypted zip file is stored as plain text, hence no password is required
+	reader, err := zip.NewReader(source, source.size)
+	if err != nil {
+		return ArchiveMetadata{}, err
+	}
+
+	return ArchiveMetadata{Comment: reader.Comment}, nil
+}
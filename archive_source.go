@@ -0,0 +1,201 @@
+package onearchiver
+
+import (
+	"context"
+	"fmt"
+	"github.com/ganeshrvel/archiver"
+	"io"
+	"os"
+)
+
+// the archive being read; the volumes of a split archive are read in place, one after another, as if they were a single file
+type archiveSource struct {
+	// name of the whole archive; the format is detected using its extension and the compressed files name their only entry after it
+	filename string
+
+	files   []*os.File
+	offsets []int64 // offset of every file within the archive
+	size    int64
+
+	// central directory and end records of a zip split set, rewritten with the offsets within the whole set; they take the place
+	// of the bytes at [patchOffset], see [archiveSource.joinZipSplitSet]
+	patch       []byte
+	patchOffset int64
+
+	// payload of an age envelope, decrypted as it is read; it takes the place of the files in [reader] and can only be read once
+	// [ReadAt] still reads the encrypted files; see [openArchiveEnvelope]
+	decrypted io.Reader
+}
+
+// opens the archive [ArchiveMeta.Filename], which can be the archive itself or any of its volumes; see [archiveVolumes]
+// a split archive is read by the name of the whole archive, hence [ArchiveMeta.Filename] is set to it
+func openArchiveSource(meta *ArchiveMeta) (*archiveSource, error) {
+	archiveFilename, volumes, err := archiveVolumes(meta.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if volumes == nil {
+		volumes = []string{meta.Filename}
+	}
+
+	source := &archiveSource{filename: archiveFilename}
+
+	for _, volume := range volumes {
+		file, err := os.Open(volume)
+		if err != nil {
+			source.close()
+
+			return nil, err
+		}
+
+		source.files = append(source.files, file)
+
+		fileInfo, err := file.Stat()
+		if err != nil {
+			source.close()
+
+			return nil, err
+		}
+
+		source.offsets = append(source.offsets, source.size)
+		source.size += fileInfo.Size()
+	}
+
+	if len(volumes) > 1 && isZipVolumeFilename(volumes[0]) {
+		if err := source.joinZipSplitSet(); err != nil {
+			source.close()
+
+			return nil, err
+		}
+	}
+
+	meta.Filename = source.filename
+
+	return source, nil
+}
+
+func (as *archiveSource) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset: %d", off)
+	}
+
+	// the patched part is copied over the bytes read from the volumes
+	defer as.applyPatch(p, off)
+
+	// the volume holding [off]
+	index := len(as.offsets) - 1
+	for index > 0 && as.offsets[index] > off {
+		index--
+	}
+
+	total := 0
+
+	// reads the tail of the volume, then moves on to the next volumes
+	for ; index < len(as.files) && len(p) > 0; index++ {
+		n, err := as.files[index].ReadAt(p, off-as.offsets[index])
+		total += n
+		off += int64(n)
+		p = p[n:]
+
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+	}
+
+	if len(p) > 0 {
+		return total, io.EOF
+	}
+
+	return total, nil
+}
+
+// copies the part of [archiveSource.patch] which overlaps the bytes [p] read at [off]
+func (as *archiveSource) applyPatch(p []byte, off int64) {
+	if as.patch == nil {
+		return
+	}
+
+	start := as.patchOffset - off
+	if start >= int64(len(p)) || start+int64(len(as.patch)) <= 0 {
+		return
+	}
+
+	if start < 0 {
+		copy(p, as.patch[-start:])
+
+		return
+	}
+
+	copy(p[start:], as.patch)
+}
+
+// returns a reader over the whole archive from its start, or over the decrypted payload of its envelope
+func (as *archiveSource) reader() io.Reader {
+	if as.decrypted != nil {
+		return as.decrypted
+	}
+
+	return io.NewSectionReader(as, 0, as.size)
+}
+
+// starts [archiveSource.reader] over from the start of the archive; the payload of an envelope is decrypted again using [meta]
+func (as *archiveSource) rewind(ctx context.Context, meta *ArchiveMeta) error {
+	if as.decrypted == nil {
+		return nil
+	}
+
+	as.decrypted = nil
+
+	_, err := openArchiveEnvelope(ctx, meta, as)
+
+	return err
+}
+
+// returns the file info of the first volume, which stands for the mode and the mod time of the archive
+func (as *archiveSource) stat() (os.FileInfo, error) {
+	return as.files[0].Stat()
+}
+
+func (as *archiveSource) close() {
+	for _, file := range as.files {
+		if err := file.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
+
+// walks the entries of the tarball or the rar archive read from [in] like [archiver.Walker],
+// but the errors returned by [walkFn] are returned as they are rather than wrapped into a string
+func walkArchive(arcReader archiver.Reader, in io.Reader, walkFn archiver.WalkFunc) error {
+	if err := arcReader.Open(in, 0); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := arcReader.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	for {
+		file, err := arcReader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = walkFn(file)
+
+		if err := file.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -1,52 +1,282 @@
 package onearchiver
 
-//import (
-//	"github.com/ganeshrvel/archiver"
-//	ignore "github.com/sabhiram/go-gitignore"
-//	"os"
-//)
-//
-//func compressFile(arc *commonArchive, newArchiveFile interface{ archiver.Compressor }, fileList *[]string) error {
-//	_filename := arc.meta.filename
-//	_gitIgnorePattern := arc.meta.gitIgnorePattern
-//	_fileList := *fileList
-//
-//	var ignoreList []string
-//	ignoreList = append(ignoreList, GlobalPatternDenylist...)
-//	ignoreList = append(ignoreList, _gitIgnorePattern...)
-//	ignoreListLength := len(ignoreList)
-//
-//	ignoreMatches := ignore.CompileIgnoreLines(ignoreList...)
-//
-//	if !indexExists(_fileList, 0) {
-//		return nil
-//	}
-//
-//	_source := _fileList[0]
-//
-//	if ignoreListLength > 0 {
-//	if ignoreMatches.MatchesPath(_source) {
-//		return nil
-//	}
-//	}
-//
-//	in, err := os.Open(_source)
-//	if err != nil {
-//		return err
-//	}
-//	defer in.Close()
-//
-//	out, err := os.Create(_filename)
-//	if err != nil {
-//		return err
-//	}
-//	defer out.Close()
-//
-//	err = newArchiveFile.Compress(in, out)
-//	if err != nil {
-//		return err
-//	}
-//	defer out.Close()
-//
-//	return err
-//}
+import (
+	"fmt"
+	"github.com/ganeshrvel/archiver"
+	"github.com/klauspost/pgzip"
+	ignore "github.com/sabhiram/go-gitignore"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checks whether [arcFileObj] is a single compressed file (.gz, .bz2..) rather than an archive
+func isCompressedFileFormat(arcFileObj interface{}) bool {
+	switch arcFileObj.(type) {
+	case *archiver.Gz, *archiver.Bz2, *archiver.Brotli, *archiver.Lz4, *archiver.Snappy, *archiver.Xz, *archiver.Zstd:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// returns the name of the file inside the compressed file [filename]; the compression extension is stripped off
+func compressedFileEntryName(filename string) string {
+	basename := filepath.Base(filename)
+
+	return strings.TrimSuffix(basename, filepath.Ext(basename))
+}
+
+// compresses a single file into a bare compressed stream
+// exactly one file is expected from [ArchivePack.FileList] and [ArchivePack.VirtualFiles] put together
+func packCompressedFile(arc *commonArchive, arcFileObj interface{}, fileList *[]string, commonParentPath string, ph *ProgressHandler) error {
+	_filename := arc.meta.Filename
+	_compression := arc.pack.Compression
+
+	zipFilePathListMap := make(map[string]createArchiveFileInfo)
+
+	err := collectFilesForPacking(&zipFilePathListMap, &arc.meta, &arc.pack, fileList, commonParentPath, false, nil)
+	if err != nil {
+		return err
+	}
+
+	var items []createArchiveFileInfo
+	for _, item := range sortedPackingFileList(zipFilePathListMap) {
+		if item.isDir || item.linkTarget != "" {
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	if len(items) != 1 {
+		return fmt.Errorf("a compressed file can only hold a single file, found %d files", len(items))
+	}
+
+	item := items[0]
+
+	out, err := createPackingOutput(_filename, arc.pack.VolumeSize)
+	if err != nil {
+		return err
+	}
+
+	envelope, err := newEnvelopeWriter(newContextWriter(arc.ctx, out), &arc.meta)
+	if err != nil {
+		out.abort()
+
+		return err
+	}
+
+	// the existing compressed file is only replaced once the new one is written in full
+	if err := writeCompressedFile(arc, arcFileObj, envelope, &item, &_compression, ph); err != nil {
+		out.abort()
+
+		return err
+	}
+
+	if err := envelope.Close(); err != nil {
+		out.abort()
+
+		return err
+	}
+
+	return out.Close()
+}
+
+func writeCompressedFile(arc *commonArchive, arcFileObj interface{}, out io.Writer, item *createArchiveFileInfo, co *CompressionOptions, ph *ProgressHandler) error {
+	compressor, err := newCompressor(arcFileObj, out, co)
+	if err != nil {
+		return err
+	}
+
+	// gzip is the only format with a header to keep the name and the mod time of the file
+	if gzipWriter, ok := compressor.(*pgzip.Writer); ok {
+		gzipWriter.Header.Name = filepath.Base(item.relativeFilePath)
+		gzipWriter.Header.ModTime = (*item.fileInfo).ModTime()
+
+		if arc.pack.Reproducible {
+			gzipWriter.Header.ModTime = arc.pack.sourceDateEpoch()
+		}
+	}
+
+	pInfo, ch := initProgress(1, packingFileSize(item), ph)
+	pInfo.progress(ch, 1, item.absFilepath, 1, packingFileSize(item))
+
+	in, err := item.open()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := in.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	if _, err := io.Copy(compressor, newProgressReader(in, pInfo.byteCounter(ch))); err != nil {
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+
+	pInfo.endProgress(ch, 1)
+
+	return nil
+}
+
+// lists the compressed file as a single entry named after [compressedFileEntryName]
+// the size is taken from the headers or the trailer of the formats which record it (see [recordedUncompressedSize]),
+// the stream is decompressed to find out the size otherwise
+func listCompressedFile(arc *commonArchive, arcFileObj interface{}) ([]ArchiveFileInfo, error) {
+	_filename := arc.meta.Filename
+	_listDirectoryPath := arc.read.ListDirectoryPath
+	_gitIgnorePattern := arc.meta.GitIgnorePattern
+
+	if _listDirectoryPath != "" {
+		return nil, fmt.Errorf("path not found to filter: %s", _listDirectoryPath)
+	}
+
+	fileInfo, err := arc.source.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	name := compressedFileEntryName(_filename)
+
+	limits := newLimitTracker(arc.read.Limits, arc.source.size)
+
+	size, ok := int64(0), false
+
+	// the envelope is only decrypted as a stream, hence the headers and the trailer can't be read in place
+	if arc.source.decrypted == nil {
+		size, ok = recordedUncompressedSize(arcFileObj, arc.source, arc.source.size)
+	}
+
+	// the size is 0 if it isn't recorded, the decompressed bytes are counted then
+	if err := limits.addEntry(name, size); err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		size, err = decompressFile(arcFileObj, arc.source.reader(), limits.writer(name, newContextWriter(arc.ctx, ioutil.Discard)), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ignoreList []string
+	ignoreList = append(ignoreList, GlobalPatternDenylist...)
+	ignoreList = append(ignoreList, _gitIgnorePattern...)
+	compiledGitIgnoreLines := ignore.CompileIgnoreLines(ignoreList...)
+
+	if compiledGitIgnoreLines.MatchesPath(name) {
+		return nil, nil
+	}
+
+	return []ArchiveFileInfo{
+		{
+			Mode:       fileInfo.Mode().Perm(),
+			Size:       size,
+			IsDir:      false,
+			ModTime:    fileInfo.ModTime(),
+			Name:       name,
+			FullPath:   name,
+			ParentPath: GetParentDirectory(name),
+			Extension:  extension(name),
+		},
+	}, nil
+}
+
+// decompresses the compressed file into [ArchiveUnpack.Destination]
+// the file takes over the permissions and the mod time of the compressed file
+func unpackCompressedFile(arc *commonArchive, arcFileObj interface{}, ph *ProgressHandler) error {
+	_filename := arc.meta.Filename
+	_gitIgnorePattern := arc.meta.GitIgnorePattern
+	_fileList := arc.unpack.FileList
+	_destination := arc.unpack.Destination
+
+	name := compressedFileEntryName(_filename)
+
+	if len(_fileList) > 0 {
+		matched := StringFilter(_fileList, func(s string) bool {
+			return subpathExists(s, name)
+		})
+
+		if len(matched) < 1 {
+			return nil
+		}
+	}
+
+	var ignoreList []string
+	ignoreList = append(ignoreList, GlobalPatternDenylist...)
+	ignoreList = append(ignoreList, _gitIgnorePattern...)
+
+	if ignore.CompileIgnoreLines(ignoreList...).MatchesPath(name) {
+		return nil
+	}
+
+	fileInfo, err := arc.source.stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(_destination, os.ModePerm); err != nil {
+		return err
+	}
+
+	_absPath := filepath.Join(_destination, name)
+
+	// the uncompressed size isn't known upfront, hence the progress follows the compressed bytes
+	pInfo, ch := initProgress(1, arc.source.size, ph)
+	pInfo.progress(ch, 1, _absPath, 1, arc.source.size)
+
+	limits := newLimitTracker(arc.unpack.Limits, arc.source.size)
+
+	// the uncompressed size isn't recorded, hence only the actual bytes are checked
+	if err := limits.addEntry(name, 0); err != nil {
+		return err
+	}
+
+	arc.unpacked.track(_absPath)
+
+	out, err := createFileBeneath(_destination, _absPath, fileInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := decompressFile(arcFileObj, arc.source.reader(), limits.writer(name, newContextWriter(arc.ctx, out)), pInfo.byteCounter(ch)); err != nil {
+		_ = out.Close()
+
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	pInfo.endProgress(ch, 1)
+
+	return os.Chtimes(_absPath, fileInfo.ModTime(), fileInfo.ModTime())
+}
+
+// decompresses [in] into [out] and returns the number of the decompressed bytes
+// [onRead] reports the compressed bytes as they are read; can be nil
+func decompressFile(arcFileObj interface{}, in io.Reader, out io.Writer, onRead func(int)) (int64, error) {
+	decompressor, err := newDecompressor(arcFileObj, newProgressReader(in, onRead))
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err := decompressor.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	return io.Copy(out, decompressor)
+}
@@ -0,0 +1,351 @@
+package onearchiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ganeshrvel/archiver"
+	"io"
+	"math"
+)
+
+// returns the uncompressed size of the compressed file as recorded in its headers or its trailer, without decompressing it
+// false is returned if the format doesn't record the size, or the file isn't laid out as expected; it has to be decompressed then
+func recordedUncompressedSize(arcFileObj interface{}, r io.ReaderAt, size int64) (int64, bool) {
+	switch arcFileObj.(type) {
+	case *archiver.Gz:
+		return gzipRecordedSize(r, size)
+
+	case *archiver.Zstd:
+		return zstdRecordedSize(r, size)
+
+	case *archiver.Xz:
+		return xzRecordedSize(r, size)
+
+	case *archiver.Lz4:
+		return lz4RecordedSize(r, size)
+
+	default:
+		return 0, false
+	}
+}
+
+// gzip keeps the size modulo 4 GiB in the trailer (ISIZE) of the last member, hence it is only trusted if the file couldn't
+// have been inflated past 4 GiB, going by the best ratio of deflate; a gzip file of several members is reported with the size
+// of its last member
+func gzipRecordedSize(r io.ReaderAt, size int64) (int64, bool) {
+	header, ok := readBytesAt(r, 0, 2)
+	if !ok || header[0] != 0x1f || header[1] != 0x8b {
+		return 0, false
+	}
+
+	if size > (1<<32)/maxDeflateRatio {
+		return 0, false
+	}
+
+	trailer, ok := readBytesAt(r, size-4, 4)
+	if !ok {
+		return 0, false
+	}
+
+	return int64(binary.LittleEndian.Uint32(trailer)), true
+}
+
+// the size is taken from the frame content size of every frame; the frames without it are decompressed
+func zstdRecordedSize(r io.ReaderAt, size int64) (int64, bool) {
+	total := int64(0)
+	offset := int64(0)
+
+	for offset < size {
+		magic, ok := readUint32At(r, offset)
+		if !ok {
+			return 0, false
+		}
+
+		if isSkippableFrame(magic) {
+			frameSize, ok := readUint32At(r, offset+4)
+			if !ok {
+				return 0, false
+			}
+
+			offset += 8 + int64(frameSize)
+
+			continue
+		}
+
+		if magic != zstdFrameMagic {
+			return 0, false
+		}
+
+		descriptor, ok := readBytesAt(r, offset+4, 1)
+		if !ok {
+			return 0, false
+		}
+
+		singleSegment := descriptor[0]&0x20 != 0
+		hasChecksum := descriptor[0]&0x04 != 0
+		contentSizeLength := []int64{0, 2, 4, 8}[descriptor[0]>>6]
+		dictionaryIDLength := []int64{0, 1, 2, 4}[descriptor[0]&0x03]
+
+		if contentSizeLength == 0 && singleSegment {
+			contentSizeLength = 1
+		}
+
+		if contentSizeLength == 0 {
+			return 0, false
+		}
+
+		pos := offset + 5 + dictionaryIDLength
+
+		// the window descriptor
+		if !singleSegment {
+			pos += 1
+		}
+
+		field, ok := readBytesAt(r, pos, contentSizeLength)
+		if !ok {
+			return 0, false
+		}
+
+		var contentSize uint64
+
+		switch contentSizeLength {
+		case 1:
+			contentSize = uint64(field[0])
+		case 2:
+			contentSize = uint64(binary.LittleEndian.Uint16(field)) + 256
+		case 4:
+			contentSize = uint64(binary.LittleEndian.Uint32(field))
+		default:
+			contentSize = binary.LittleEndian.Uint64(field)
+		}
+
+		pos += contentSizeLength
+
+		for {
+			blockHeader, ok := readBytesAt(r, pos, 3)
+			if !ok {
+				return 0, false
+			}
+
+			value := uint32(blockHeader[0]) | uint32(blockHeader[1])<<8 | uint32(blockHeader[2])<<16
+			pos += 3
+
+			switch (value >> 1) & 0x03 {
+			// rle blocks hold a single byte
+			case 1:
+				pos += 1
+
+			case 3:
+				return 0, false
+
+			default:
+				pos += int64(value >> 3)
+			}
+
+			if value&0x01 != 0 {
+				break
+			}
+		}
+
+		if hasChecksum {
+			pos += 4
+		}
+
+		if contentSize > uint64(math.MaxInt64-total) {
+			return 0, false
+		}
+
+		total += int64(contentSize)
+		offset = pos
+	}
+
+	return total, offset == size
+}
+
+// the size is taken from the index of the stream; the files of several streams are decompressed
+func xzRecordedSize(r io.ReaderAt, size int64) (int64, bool) {
+	header, ok := readBytesAt(r, 0, 6)
+	if !ok || !bytes.Equal(header, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}) {
+		return 0, false
+	}
+
+	footer, ok := readBytesAt(r, size-12, 12)
+	if !ok || !bytes.Equal(footer[10:], []byte("YZ")) {
+		return 0, false
+	}
+
+	indexSize := (int64(binary.LittleEndian.Uint32(footer[4:8])) + 1) * 4
+
+	index, ok := readBytesAt(r, size-12-indexSize, indexSize)
+	if !ok || index[0] != 0x00 {
+		return 0, false
+	}
+
+	pos := 1
+
+	records, ok := readXzVarint(index, &pos)
+	if !ok {
+		return 0, false
+	}
+
+	blocksSize := int64(0)
+	total := int64(0)
+
+	for i := int64(0); i < records; i++ {
+		unpaddedSize, ok := readXzVarint(index, &pos)
+		if !ok {
+			return 0, false
+		}
+
+		uncompressedSize, ok := readXzVarint(index, &pos)
+		if !ok {
+			return 0, false
+		}
+
+		if uncompressedSize > math.MaxInt64-total {
+			return 0, false
+		}
+
+		// the blocks are padded to a multiple of 4 bytes
+		blocksSize += (unpaddedSize + 3) &^ 3
+		total += uncompressedSize
+	}
+
+	// the stream header and footer take 12 bytes each
+	if 12+blocksSize+indexSize+12 != size {
+		return 0, false
+	}
+
+	return total, true
+}
+
+// reads a multibyte integer of xz from [b] at [pos], moving [pos] past it
+func readXzVarint(b []byte, pos *int) (int64, bool) {
+	var value uint64
+
+	for i := 0; i < 9 && *pos < len(b); i++ {
+		c := b[*pos]
+		*pos += 1
+
+		value |= uint64(c&0x7f) << (7 * i)
+
+		if c&0x80 == 0 {
+			return int64(value), value <= math.MaxInt64
+		}
+	}
+
+	return 0, false
+}
+
+// the size is taken from the content size of every frame; the frames without it are decompressed
+func lz4RecordedSize(r io.ReaderAt, size int64) (int64, bool) {
+	total := int64(0)
+	offset := int64(0)
+
+	for offset < size {
+		magic, ok := readUint32At(r, offset)
+		if !ok {
+			return 0, false
+		}
+
+		if isSkippableFrame(magic) {
+			frameSize, ok := readUint32At(r, offset+4)
+			if !ok {
+				return 0, false
+			}
+
+			offset += 8 + int64(frameSize)
+
+			continue
+		}
+
+		if magic != lz4FrameMagic {
+			return 0, false
+		}
+
+		descriptor, ok := readBytesAt(r, offset+4, 1)
+		if !ok || descriptor[0]>>6 != 1 || descriptor[0]&0x08 == 0 {
+			return 0, false
+		}
+
+		hasBlockChecksum := descriptor[0]&0x10 != 0
+		hasContentChecksum := descriptor[0]&0x04 != 0
+		hasDictionaryID := descriptor[0]&0x01 != 0
+
+		field, ok := readBytesAt(r, offset+6, 8)
+		if !ok {
+			return 0, false
+		}
+
+		contentSize := binary.LittleEndian.Uint64(field)
+
+		// the flags, the block descriptor, the content size and the header checksum
+		pos := offset + 4 + 2 + 8 + 1
+
+		if hasDictionaryID {
+			pos += 4
+		}
+
+		for {
+			blockSize, ok := readUint32At(r, pos)
+			if !ok {
+				return 0, false
+			}
+
+			pos += 4
+
+			// the end mark
+			if blockSize == 0 {
+				break
+			}
+
+			// the highest bit marks an uncompressed block
+			pos += int64(blockSize & 0x7fffffff)
+
+			if hasBlockChecksum {
+				pos += 4
+			}
+		}
+
+		if hasContentChecksum {
+			pos += 4
+		}
+
+		if contentSize > uint64(math.MaxInt64-total) {
+			return 0, false
+		}
+
+		total += int64(contentSize)
+		offset = pos
+	}
+
+	return total, offset == size
+}
+
+// the skippable frames are shared by zstd and lz4
+func isSkippableFrame(magic uint32) bool {
+	return magic&0xfffffff0 == 0x184d2a50
+}
+
+func readUint32At(r io.ReaderAt, offset int64) (uint32, bool) {
+	b, ok := readBytesAt(r, offset, 4)
+	if !ok {
+		return 0, false
+	}
+
+	return binary.LittleEndian.Uint32(b), true
+}
+
+func readBytesAt(r io.ReaderAt, offset int64, length int64) ([]byte, bool) {
+	if offset < 0 || length < 0 || length > maxRecordedSizeRead {
+		return nil, false
+	}
+
+	b := make([]byte, length)
+
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
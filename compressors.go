@@ -0,0 +1,130 @@
+package onearchiver
+
+import (
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/dsnet/compress/bzip2"
+	"github.com/ganeshrvel/archiver"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/ioutil"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// returns the compression level; falls back to [DefaultCompressionLevel] if it is not set
+func (co *CompressionOptions) level() int {
+	if co.Level == 0 {
+		return DefaultCompressionLevel
+	}
+
+	return co.Level
+}
+
+// returns the brotli quality; falls back to the compression level if it is not set
+func (co *CompressionOptions) brotliQuality() int {
+	if co.BrotliQuality == 0 {
+		return co.level()
+	}
+
+	return co.BrotliQuality
+}
+
+// wraps [out] with the compressor of the tarball or the compressed file format [arcFileObj]
+// the returned writer has to be closed to flush the compressed stream, [out] is left open
+func newCompressor(arcFileObj interface{}, out io.Writer, co *CompressionOptions) (io.WriteCloser, error) {
+	switch arcFileObj.(type) {
+	case *archiver.Tar:
+		return nopWriteCloser{out}, nil
+
+	case *archiver.TarGz, *archiver.Gz:
+		return pgzip.NewWriterLevel(out, co.level())
+
+	case *archiver.TarBz2, *archiver.Bz2:
+		return bzip2.NewWriter(out, &bzip2.WriterConfig{Level: co.level()})
+
+	case *archiver.TarBrotli, *archiver.Brotli:
+		return brotli.NewWriterLevel(out, co.brotliQuality()), nil
+
+	case *archiver.TarLz4, *archiver.Lz4:
+		w := lz4.NewWriter(out)
+		w.Header.CompressionLevel = co.level()
+
+		return w, nil
+
+	case *archiver.TarSz, *archiver.Snappy:
+		return snappy.NewBufferedWriter(out), nil
+
+	case *archiver.TarXz, *archiver.Xz:
+		return xz.WriterConfig{DictCap: co.XzDictCap}.NewWriter(out)
+
+	case *archiver.TarZstd, *archiver.Zstd:
+		var opts []zstd.EOption
+
+		// zstd used to be packed with the encoder defaults; only override the level if it was explicitly asked for
+		if co.Level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(co.Level)))
+		}
+
+		if co.ZstdWindowSize != 0 {
+			opts = append(opts, zstd.WithWindowSize(co.ZstdWindowSize))
+		}
+
+		return zstd.NewWriter(out, opts...)
+
+	default:
+		return nil, fmt.Errorf("archive file format is not supported")
+	}
+}
+
+// wraps [in] with the decompressor of the tarball or the compressed file format [arcFileObj]
+func newDecompressor(arcFileObj interface{}, in io.Reader) (io.ReadCloser, error) {
+	switch arcFileObj.(type) {
+	case *archiver.Tar:
+		return ioutil.NopCloser(in), nil
+
+	case *archiver.TarGz, *archiver.Gz:
+		return pgzip.NewReader(in)
+
+	case *archiver.TarBz2, *archiver.Bz2:
+		return bzip2.NewReader(in, nil)
+
+	case *archiver.TarBrotli, *archiver.Brotli:
+		return ioutil.NopCloser(brotli.NewReader(in)), nil
+
+	case *archiver.TarLz4, *archiver.Lz4:
+		return ioutil.NopCloser(lz4.NewReader(in)), nil
+
+	case *archiver.TarSz, *archiver.Snappy:
+		return ioutil.NopCloser(snappy.NewReader(in)), nil
+
+	case *archiver.TarXz, *archiver.Xz:
+		r, err := xz.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.NopCloser(r), nil
+
+	case *archiver.TarZstd, *archiver.Zstd:
+		r, err := zstd.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.IOReadCloser(), nil
+
+	default:
+		return nil, fmt.Errorf("archive file format is not supported")
+	}
+}
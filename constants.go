@@ -1,14 +1,99 @@
 package onearchiver
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 var (
 	GlobalPatternDenylist = []string{"pax_global_header", "__MACOSX/*", "*.DS_Store"}
 	PathSep               = string(os.PathSeparator)
+
+	// already compressed file formats which gain nothing from deflating them again
+	DefaultStoredExtensions = []string{
+		"zip", "gz", "tgz", "bz2", "xz", "zst", "lz4", "br", "sz", "7z", "rar",
+		"jar", "apk", "docx", "xlsx", "pptx", "odt", "epub",
+		"jpg", "jpeg", "png", "gif", "webp", "heic", "avif",
+		"mp3", "m4a", "aac", "ogg", "opus", "flac",
+		"mp4", "m4v", "mov", "mkv", "webm", "avi",
+	}
+
+	// ignore files which are usually found in a source tree; see [ArchivePack.IgnoreFileNames]
+	DefaultIgnoreFileNames = []string{".gitignore", ".archiveignore"}
+
+	minZipModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
 )
 
 const (
-	OverwriteExisting = true
+	// an existing archive is replaced on packing, along with the volumes of an earlier split packing of it;
+	// see [ArchivePack.VolumeSize]
+	OverwriteExisting       = true
+	DefaultCompressionLevel = 9
+
+	// number of bytes deflated to probe whether a file is worth compressing
+	compressibilityProbeSize = 64 * 1024
+
+	// the file is stored if the probe doesn't shrink below this ratio
+	compressibilityProbeRatio = 0.95
+
+	// resolution of the mod times stored in the archives; used to figure out whether an archived file has changed
+	zipModTimePrecision = 2 * time.Second
+	tarModTimePrecision = time.Second
+
+	// minimum interval between the progress updates sent while a file is being read
+	progressReportInterval = 100 * time.Millisecond
+
+	// [ArchiveLimits.MaxCompressionRatio] is only checked past this many uncompressed bytes,
+	// so that the small and highly compressible archives don't trip it
+	compressionRatioGraceSize = 1024 * 1024
+
+	// best compression ratio of deflate: a run of 258 bytes in a single bit, along with the block overhead
+	maxDeflateRatio = 1032
+
+	// size of a tar header or data block
+	blockSize = 512
+
+	// size of a compressed zip entry which is kept in the memory while packing in parallel; larger entries are spilled to a temp file
+	parallelZipSpillSize = 8 * 1024 * 1024
+
+	// pax record prefix of the extended attributes, as written by gnu tar and star
+	paxXattrPrefix = "SCHILY.xattr."
+
+	// pax record prefix of the gnu sparse files
+	paxGNUSparsePrefix = "GNU.sparse."
+
+	// the runs of zeros of this size are left as holes while unpacking a sparse file
+	sparseHoleSize = 4096
+
+	// largest size or mod time and largest uid or gid which fit into the octal fields of a ustar header
+	maxUSTARNumber = 1<<33 - 1
+	maxUSTARId     = 1<<21 - 1
+
+	// number of the symlinks followed while resolving a symlink target before giving up on it as a loop; same as linux
+	maxSymlinkHops = 40
+
+	// signatures of the zip records which are rewritten for the zip split sets; see [writeZipSplitSet]
+	zipSplitSignature         = 0x08074b50
+	zipCentralHeaderSignature = 0x02014b50
+	zipEndSignature           = 0x06054b50
+	zip64EndSignature         = 0x06064b50
+	zip64LocatorSignature     = 0x07064b50
+
+	// magic numbers of the zstd and the lz4 frames
+	zstdFrameMagic = 0xfd2fb528
+	lz4FrameMagic  = 0x184d2204
+
+	// the headers and the indexes which are read to find out the uncompressed size of a compressed file are refused past this size
+	maxRecordedSizeRead = 16 * 1024 * 1024
+
+	// first line of the age encrypted envelopes
+	ageEnvelopeHeader = "age-encryption.org/v1\n"
+
+	// keeps the in-memory files apart from the files on the disk while packing
+	virtualFileKeyPrefix = "virtual://"
+
+	// keeps the files packed through [ArchivePack.PathMappings] apart from the same files in [ArchivePack.FileList]
+	pathMappingKeyPrefix = "mapping://"
 )
 
 var allowedSecondExtensions allowedSecondExtMap = map[string]string{"tar": "tar"}
@@ -0,0 +1,144 @@
+package onearchiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrCancelled is returned by the context-aware operations once their context is cancelled or its deadline passes
+// the error of the context is wrapped along, hence [context.Canceled] and [context.DeadlineExceeded] can be checked too
+var ErrCancelled = errors.New("operation cancelled")
+
+type cancelledError struct {
+	err error
+}
+
+func (e *cancelledError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrCancelled, e.err)
+}
+
+func (e *cancelledError) Unwrap() error {
+	return e.err
+}
+
+func (e *cancelledError) Is(target error) bool {
+	return target == ErrCancelled
+}
+
+// returns [ErrCancelled] once [ctx] is done; a nil [ctx] is never done
+func checkContext(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &cancelledError{err: err}
+	}
+
+	return nil
+}
+
+func isCancelled(err error) bool {
+	return errors.Is(err, ErrCancelled)
+}
+
+// checks [ctx] before every read, so that copying a large file stops midway
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx == nil {
+		return r
+	}
+
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := checkContext(cr.ctx); err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
+
+// checks [ctx] before every write, so that writing an archive stops midway
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func newContextWriter(ctx context.Context, w io.Writer) io.Writer {
+	if ctx == nil {
+		return w
+	}
+
+	return &contextWriter{ctx: ctx, w: w}
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := checkContext(cw.ctx); err != nil {
+		return 0, err
+	}
+
+	return cw.w.Write(p)
+}
+
+// remembers the paths which didn't exist before unpacking, so that they can be removed if the unpacking is cancelled
+// the files which existed already are left as they are, even if they were overwritten
+type unpackedPaths struct {
+	destination string
+	created     []string
+}
+
+func newUnpackedPaths(destination string) *unpackedPaths {
+	up := &unpackedPaths{destination: filepath.Clean(destination)}
+
+	if !exists(up.destination) {
+		up.created = append(up.created, up.destination)
+	}
+
+	return up
+}
+
+// to be called before writing [filename]; records [filename] along with its missing parent directories
+// a nil [unpackedPaths] records nothing
+func (up *unpackedPaths) track(filename string) {
+	if up == nil {
+		return
+	}
+
+	var missing []string
+
+	for path := filepath.Clean(filename); path != up.destination && isPathWithin(up.destination, path); path = filepath.Dir(path) {
+		if _, err := os.Lstat(path); err == nil {
+			break
+		}
+
+		missing = append(missing, path)
+	}
+
+	// the parent directories come first, so that they are removed last
+	for i := len(missing) - 1; i >= 0; i-- {
+		up.created = append(up.created, missing[i])
+	}
+}
+
+// removes the recorded paths in the reverse order; a directory which holds any other file is left behind
+func (up *unpackedPaths) remove() {
+	if up == nil {
+		return
+	}
+
+	for i := len(up.created) - 1; i >= 0; i-- {
+		_ = os.Remove(up.created[i])
+	}
+
+	up.created = nil
+}
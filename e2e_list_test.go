@@ -980,6 +980,25 @@ func TestArchiveListing(t *testing.T) {
 		_testArchiveListing(_metaObj, false)
 	})
 
+	Convey("Archive Listing | Gz (compressed file)", t, func() {
+		filename := getTestMocksAsset("mock_test_file1.gz")
+		_metaObj := &ArchiveMeta{Filename: filename}
+
+		_listObj := &ArchiveRead{
+			ListDirectoryPath: "",
+			Recursive:         true,
+			OrderBy:           OrderByFullPath,
+			OrderDir:          OrderDirAsc,
+		}
+
+		result, err := GetArchiveFileList(_metaObj, _listObj)
+
+		So(err, ShouldBeNil)
+		So(result, ShouldHaveLength, 1)
+		So(result[0].FullPath, ShouldEqual, "mock_test_file1")
+		So(result[0].Size, ShouldEqual, 1627)
+	})
+
 	Convey("Archive Listing | Non encrypted Rar", t, func() {
 		filename := getTestMocksAsset("mock_test_file1.rar")
 		_metaObj := &ArchiveMeta{Filename: filename}
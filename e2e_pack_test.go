@@ -1,9 +1,23 @@
 package onearchiver
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"filippo.io/age"
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/yeka/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO symlink and hardlink
@@ -30,6 +44,34 @@ func _testListingPackedArchive(_metaObj *ArchiveMeta, assertionArr []string) {
 	})
 }
 
+// the entries which don't come from the disk are ordered differently by the listing, hence only the set of paths is compared
+func _testListingPackedArchiveUnordered(_metaObj *ArchiveMeta, assertionArr []string) {
+	Convey("recursive=true | unordered - it should not throw an error", func() {
+		_listObj := &ArchiveRead{
+			ListDirectoryPath: "",
+			Recursive:         true,
+			OrderBy:           OrderByFullPath,
+			OrderDir:          OrderDirAsc,
+		}
+
+		result, err := GetArchiveFileList(_metaObj, _listObj)
+
+		So(err, ShouldBeNil)
+
+		var itemsArr []string
+
+		for _, item := range result {
+			itemsArr = append(itemsArr, item.FullPath)
+		}
+
+		So(itemsArr, ShouldHaveLength, len(assertionArr))
+
+		for _, item := range assertionArr {
+			So(itemsArr, ShouldContain, item)
+		}
+	})
+}
+
 func _testPacking(_metaObj *ArchiveMeta, ph *ProgressHandler) {
 	Convey("gitIgnorePattern | It should not throw an error", func() {
 		path1 := getTestMocksAsset("mock_dir1")
@@ -395,6 +437,231 @@ func _testPacking(_metaObj *ArchiveMeta, ph *ProgressHandler) {
 			_testListingPackedArchive(_metaObj, assertionArr)
 		})
 	})
+
+	Convey("symlink | SymlinkPolicyStore | It should not throw an error", func() {
+		path1 := getTestMocksAsset("mock_dir4/")
+		_packObj := &ArchivePack{
+			FileList:      []string{path1},
+			SymlinkPolicy: SymlinkPolicyStore,
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			assertionArr := []string{"a.txt", "b.txt", "1/", "1/a.txt", "2/", "2/b.txt", "3/", "3/b.txt", "3/2/", "3/2/b.txt"}
+
+			_testListingPackedArchive(_metaObj, assertionArr)
+		})
+
+		Convey("Unpack Packed Archive files", func() {
+			_destination := newTempMocksDir("arc_test_pack_symlink", true)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:    []string{},
+				Destination: _destination,
+			}
+
+			err := StartUnpacking(_metaObj, unpackObj, ph)
+
+			So(err, ShouldBeNil)
+
+			linkTarget, err := os.Readlink(filepath.Join(_destination, "b.txt"))
+
+			So(err, ShouldBeNil)
+			So(linkTarget, ShouldEqual, "mock_dir1/a.txt")
+		})
+	})
+
+	Convey("virtual files | mixed with 'fileList' | It should not throw an error", func() {
+		path1 := getTestMocksAsset("mock_dir1/a.txt")
+		_packObj := &ArchivePack{
+			FileList: []string{path1},
+			VirtualFiles: []VirtualFile{
+				{Name: "reports/"},
+				{Name: "reports/summary.txt", Bytes: []byte("summary")},
+				{Name: "notes.txt", Reader: strings.NewReader("notes")},
+			},
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			_listObj := &ArchiveRead{
+				Recursive: true,
+				OrderBy:   OrderByFullPath,
+				OrderDir:  OrderDirAsc,
+			}
+
+			result, err := GetArchiveFileList(_metaObj, _listObj)
+
+			So(err, ShouldBeNil)
+
+			var itemsArr []string
+
+			for _, item := range result {
+				itemsArr = append(itemsArr, item.FullPath)
+			}
+
+			So(itemsArr, ShouldHaveLength, 4)
+			So(itemsArr, ShouldContain, "a.txt")
+			So(itemsArr, ShouldContain, "notes.txt")
+			So(itemsArr, ShouldContain, "reports/")
+			So(itemsArr, ShouldContain, "reports/summary.txt")
+		})
+
+		Convey("Unpack Packed Archive files", func() {
+			_destination := newTempMocksDir("arc_test_pack_virtual", true)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:    []string{},
+				Destination: _destination,
+			}
+
+			err := StartUnpacking(_metaObj, unpackObj, ph)
+
+			So(err, ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(filepath.Join(_destination, "reports/summary.txt"))
+
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "summary")
+
+			contents, err = ioutil.ReadFile(filepath.Join(_destination, "notes.txt"))
+
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "notes")
+		})
+	})
+
+	Convey("path mappings | archive prefix | It should not throw an error", func() {
+		_packObj := &ArchivePack{
+			PathMappings: []PathMapping{
+				{Source: getTestMocksAsset("mock_dir1/1"), ArchivePath: "logs/one"},
+				{Source: getTestMocksAsset("mock_dir1/a.txt"), ArchivePath: "config/a.conf"},
+			},
+			ArchivePrefix: "release",
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			assertionArr := []string{"release/", "release/config/", "release/config/a.conf", "release/logs/", "release/logs/one/", "release/logs/one/a.txt"}
+
+			_testListingPackedArchiveUnordered(_metaObj, assertionArr)
+		})
+	})
+
+	Convey("path mappings | directory contents at the root | It should not throw an error", func() {
+		_packObj := &ArchivePack{
+			FileList: []string{getTestMocksAsset("mock_dir1/a.txt")},
+			PathMappings: []PathMapping{
+				{Source: getTestMocksAsset("mock_dir1/3"), ArchivePath: ""},
+			},
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			assertionArr := []string{"a.txt", "b.txt", "2/", "2/b.txt"}
+
+			_testListingPackedArchiveUnordered(_metaObj, assertionArr)
+		})
+	})
+
+	Convey("path mappings | invalid archive path | It should throw an error", func() {
+		_packObj := &ArchivePack{
+			PathMappings: []PathMapping{
+				{Source: getTestMocksAsset("mock_dir1/a.txt"), ArchivePath: "../a.txt"},
+			},
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("path mappings | same archive path as a file in the file list | It should throw an error", func() {
+		_packObj := &ArchivePack{
+			FileList: []string{getTestMocksAsset("mock_dir1/a.txt")},
+			PathMappings: []PathMapping{
+				{Source: getTestMocksAsset("mock_dir1/1/a.txt"), ArchivePath: "a.txt"},
+			},
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("path mappings | same archive path as another mapping | It should throw an error", func() {
+		_packObj := &ArchivePack{
+			PathMappings: []PathMapping{
+				{Source: getTestMocksAsset("mock_dir1/a.txt"), ArchivePath: "config/a.conf"},
+				{Source: getTestMocksAsset("mock_dir1/1/a.txt"), ArchivePath: "config/a.conf"},
+			},
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("path mappings | directories at the same archive path | It should not throw an error", func() {
+		_packObj := &ArchivePack{
+			PathMappings: []PathMapping{
+				{Source: getTestMocksAsset("mock_dir1/1"), ArchivePath: "logs/one"},
+				{Source: getTestMocksAsset("mock_dir1/3"), ArchivePath: "logs"},
+			},
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			assertionArr := []string{"logs/", "logs/one/", "logs/one/a.txt", "logs/b.txt", "logs/2/", "logs/2/b.txt"}
+
+			_testListingPackedArchiveUnordered(_metaObj, assertionArr)
+		})
+	})
+
+	Convey("virtual files | invalid name | It should throw an error", func() {
+		_packObj := &ArchivePack{
+			VirtualFiles: []VirtualFile{
+				{Name: "../escape.txt", Bytes: []byte("escape")},
+			},
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("symlink | SymlinkPolicyFollow | dangling symlink | It should not throw an error", func() {
+		path1 := getTestMocksAsset("mock_dir4/")
+		_packObj := &ArchivePack{
+			FileList:      []string{path1},
+			SymlinkPolicy: SymlinkPolicyFollow,
+		}
+
+		err := StartPacking(_metaObj, _packObj, ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			assertionArr := []string{"a.txt", "1/", "1/a.txt", "2/", "2/b.txt", "3/", "3/b.txt", "3/2/", "3/2/b.txt"}
+
+			_testListingPackedArchive(_metaObj, assertionArr)
+		})
+	})
 }
 
 func TestPacking(t *testing.T) {
@@ -502,4 +769,1684 @@ func TestPacking(t *testing.T) {
 
 		_testPacking(_metaObj, &ph)
 	})
+
+	Convey("Packing | Compression options", t, func() {
+		path1 := getTestMocksAsset("mock_dir1")
+		assertionArr := []string{"mock_dir1/", "mock_dir1/a.txt", "mock_dir1/1/", "mock_dir1/1/a.txt", "mock_dir1/2/", "mock_dir1/2/b.txt", "mock_dir1/3/", "mock_dir1/3/b.txt", "mock_dir1/3/2/", "mock_dir1/3/2/b.txt"}
+
+		for _, f := range []string{"arc_test_pack_options.zip", "arc_test_pack_options.tar.gz", "arc_test_pack_options.tar.br", "arc_test_pack_options.tar.xz", "arc_test_pack_options.tar.zst"} {
+			filename := newTempMocksAsset(f)
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", f), func() {
+				_metaObj := &ArchiveMeta{Filename: filename}
+
+				_packObj := &ArchivePack{
+					FileList: []string{path1},
+					Compression: CompressionOptions{
+						Level:          1,
+						BrotliQuality:  2,
+						ZstdWindowSize: 1 << 20,
+						XzDictCap:      1 << 20,
+					},
+				}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				_testListingPackedArchive(_metaObj, assertionArr)
+			})
+		}
+
+		Convey("zip (encrypted) | It should apply the compression level", func() {
+			source := newTempMocksDir("arc_test_pack_options_src", true)
+
+			So(ioutil.WriteFile(filepath.Join(source, "a.txt"), bytes.Repeat([]byte("onearchiver "), 8*1024), 0644), ShouldBeNil)
+
+			sizes := make(map[int]int64)
+
+			for _, level := range []int{flate.HuffmanOnly, flate.BestCompression} {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_options_encrypted_%d.zip", level))
+
+				err := StartPacking(&ArchiveMeta{Filename: filename, Password: "1234567"}, &ArchivePack{
+					FileList:    []string{source},
+					Compression: CompressionOptions{Level: level},
+				}, &ph)
+
+				So(err, ShouldBeNil)
+
+				fileInfo, err := os.Stat(filename)
+
+				So(err, ShouldBeNil)
+
+				sizes[level] = fileInfo.Size()
+			}
+
+			So(sizes[flate.BestCompression], ShouldBeLessThan, sizes[flate.HuffmanOnly])
+		})
+
+		Convey("zip (encrypted) | It should refuse the compression methods", func() {
+			filename := newTempMocksAsset("arc_test_pack_options_encrypted.zip")
+
+			err := StartPacking(&ArchiveMeta{Filename: filename, Password: "1234567"}, &ArchivePack{
+				FileList: []string{path1},
+				CompressionMethodFunc: func(relativeFilePath string, fileInfo os.FileInfo) (uint16, bool) {
+					return zip.Store, true
+				},
+			}, &ph)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Packing | Selective compression - ZIP", t, func() {
+		path1 := getTestMocksAsset("mock_dir1")
+		filename := newTempMocksAsset("arc_test_pack_selective.zip")
+
+		_metaObj := &ArchiveMeta{Filename: filename}
+
+		Convey("Stored extensions | It should not throw an error", func() {
+			_packObj := &ArchivePack{
+				FileList:             []string{path1},
+				SelectiveCompression: true,
+				StoredExtensions:     []string{"txt"},
+			}
+
+			err := StartPacking(_metaObj, _packObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			reader, err := zip.OpenReader(filename)
+
+			So(err, ShouldBeNil)
+
+			for _, file := range reader.File {
+				if !file.FileInfo().IsDir() {
+					So(file.Method, ShouldEqual, zip.Store)
+				}
+			}
+
+			So(reader.Close(), ShouldBeNil)
+		})
+
+		Convey("CompressionMethodFunc | It should not throw an error", func() {
+			_packObj := &ArchivePack{
+				FileList:             []string{path1},
+				SelectiveCompression: true,
+				StoredExtensions:     []string{"txt"},
+				CompressionMethodFunc: func(relativeFilePath string, fileInfo os.FileInfo) (uint16, bool) {
+					return zip.Deflate, relativeFilePath == "mock_dir1/a.txt"
+				},
+			}
+
+			err := StartPacking(_metaObj, _packObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			reader, err := zip.OpenReader(filename)
+
+			So(err, ShouldBeNil)
+
+			for _, file := range reader.File {
+				if file.Name == "mock_dir1/a.txt" {
+					So(file.Method, ShouldEqual, zip.Deflate)
+				} else if !file.FileInfo().IsDir() {
+					So(file.Method, ShouldEqual, zip.Store)
+				}
+			}
+
+			So(reader.Close(), ShouldBeNil)
+		})
+	})
+
+	Convey("Packing | Reproducible", t, func() {
+		path1 := getTestMocksAsset("mock_dir1")
+		sourceDateEpoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		for _, f := range []string{"zip", "tar", "tar.gz", "tar.zst"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", ext), func() {
+				var archiveBytes [][]byte
+
+				for i := 0; i < 2; i++ {
+					filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_reproducible_%d.%s", i, ext))
+					_metaObj := &ArchiveMeta{Filename: filename}
+
+					_packObj := &ArchivePack{
+						FileList:        []string{path1},
+						Reproducible:    true,
+						SourceDateEpoch: sourceDateEpoch,
+					}
+
+					err := StartPacking(_metaObj, _packObj, &ph)
+
+					So(err, ShouldBeNil)
+
+					b, err := ioutil.ReadFile(filename)
+
+					So(err, ShouldBeNil)
+
+					archiveBytes = append(archiveBytes, b)
+
+					if ext == "tar" {
+						result, err := GetArchiveFileList(_metaObj, &ArchiveRead{Recursive: true, OrderDir: OrderDirNone})
+
+						So(err, ShouldBeNil)
+
+						for _, item := range result {
+							So(item.ModTime.Equal(sourceDateEpoch), ShouldBeTrue)
+						}
+					}
+				}
+
+				So(archiveBytes[0], ShouldResemble, archiveBytes[1])
+			})
+		}
+	})
+
+	Convey("Packing | Preserve metadata - Tar", t, func() {
+		filename := newTempMocksAsset("arc_test_pack_metadata.tar")
+		source := newTempMocksDir("arc_test_pack_metadata_src", true)
+		sourceFile := filepath.Join(source, "a.txt")
+		modTime := time.Date(2020, 1, 1, 10, 20, 30, 123456789, time.UTC)
+
+		So(ioutil.WriteFile(sourceFile, []byte("a"), 0644), ShouldBeNil)
+		So(os.Chtimes(sourceFile, modTime, modTime), ShouldBeNil)
+
+		So(writeXattr(sourceFile, "user.onearchiver", "test"), ShouldBeNil)
+
+		// the filesystem of the test environment might not support the user extended attributes
+		sourceXattrs, err := readXattrs(sourceFile)
+
+		So(err, ShouldBeNil)
+
+		conveyXattrs := Convey
+		xattrsConveyName := "Unpacked extended attributes"
+
+		if _, ok := sourceXattrs["user.onearchiver"]; !ok {
+			conveyXattrs = SkipConvey
+			xattrsConveyName += " | skipped: the filesystem of the test environment doesn't support the user extended attributes"
+		}
+
+		_metaObj := &ArchiveMeta{Filename: filename}
+		_packObj := &ArchivePack{
+			FileList:         []string{sourceFile},
+			PreserveMetadata: true,
+		}
+
+		err = StartPacking(_metaObj, _packObj, &ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			result, err := GetArchiveFileList(_metaObj, &ArchiveRead{Recursive: true, OrderDir: OrderDirNone})
+
+			So(err, ShouldBeNil)
+			So(result, ShouldHaveLength, 1)
+			So(result[0].ModTime.Equal(modTime), ShouldBeTrue)
+		})
+
+		Convey("Unpack Packed Archive files", func() {
+			_destination := newTempMocksDir("arc_test_pack_metadata", true)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:         []string{},
+				Destination:      _destination,
+				PreserveMetadata: true,
+			}
+
+			err := StartUnpacking(_metaObj, unpackObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			unpackedFile := filepath.Join(_destination, "a.txt")
+
+			fileInfo, err := os.Stat(unpackedFile)
+
+			So(err, ShouldBeNil)
+			So(fileInfo.ModTime().Equal(modTime), ShouldBeTrue)
+
+			conveyXattrs(xattrsConveyName, func() {
+				xattrs, err := readXattrs(unpackedFile)
+
+				So(err, ShouldBeNil)
+				So(xattrs["user.onearchiver"], ShouldEqual, "test")
+			})
+		})
+	})
+
+	Convey("Packing | Hard links - Tar", t, func() {
+		filename := newTempMocksAsset("arc_test_pack_hard_links.tar")
+		source := newTempMocksDir("arc_test_pack_hard_links_src", true)
+
+		So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("hard link"), 0644), ShouldBeNil)
+		So(os.Link(filepath.Join(source, "a.txt"), filepath.Join(source, "b.txt")), ShouldBeNil)
+
+		_metaObj := &ArchiveMeta{Filename: filename}
+		_packObj := &ArchivePack{
+			FileList:        []string{source},
+			DetectHardLinks: true,
+		}
+
+		err := StartPacking(_metaObj, _packObj, &ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("Tar headers", func() {
+			file, err := os.Open(filename)
+
+			So(err, ShouldBeNil)
+
+			defer file.Close()
+
+			headers := make(map[string]*tar.Header)
+			tarReader := tar.NewReader(file)
+
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+
+				So(err, ShouldBeNil)
+
+				headers[header.Name] = header
+			}
+
+			So(headers["arc_test_pack_hard_links_src/a.txt"].Typeflag, ShouldEqual, tar.TypeReg)
+			So(headers["arc_test_pack_hard_links_src/b.txt"].Typeflag, ShouldEqual, tar.TypeLink)
+			So(headers["arc_test_pack_hard_links_src/b.txt"].Linkname, ShouldEqual, "arc_test_pack_hard_links_src/a.txt")
+		})
+
+		Convey("Unpack Packed Archive files", func() {
+			_destination := newTempMocksDir("arc_test_pack_hard_links", true)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:    []string{},
+				Destination: _destination,
+			}
+
+			err := StartUnpacking(_metaObj, unpackObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			fileInfoA, err := os.Stat(filepath.Join(_destination, "arc_test_pack_hard_links_src/a.txt"))
+
+			So(err, ShouldBeNil)
+
+			fileInfoB, err := os.Stat(filepath.Join(_destination, "arc_test_pack_hard_links_src/b.txt"))
+
+			So(err, ShouldBeNil)
+			So(os.SameFile(fileInfoA, fileInfoB), ShouldBeTrue)
+		})
+
+		Convey("Unpack the hard link only | It should write the data of its target", func() {
+			_destination := newTempMocksDir("arc_test_pack_hard_links_only", true)
+
+			// an unrelated file at the path of the target, which is not unpacked
+			So(os.MkdirAll(filepath.Join(_destination, "arc_test_pack_hard_links_src"), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(_destination, "arc_test_pack_hard_links_src/a.txt"), []byte("stale"), 0644), ShouldBeNil)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:    []string{"arc_test_pack_hard_links_src/b.txt"},
+				Destination: _destination,
+			}
+
+			err := StartUnpacking(_metaObj, unpackObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(filepath.Join(_destination, "arc_test_pack_hard_links_src/b.txt"))
+
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "hard link")
+
+			contents, err = ioutil.ReadFile(filepath.Join(_destination, "arc_test_pack_hard_links_src/a.txt"))
+
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "stale")
+
+			fileInfoA, err := os.Stat(filepath.Join(_destination, "arc_test_pack_hard_links_src/a.txt"))
+
+			So(err, ShouldBeNil)
+
+			fileInfoB, err := os.Stat(filepath.Join(_destination, "arc_test_pack_hard_links_src/b.txt"))
+
+			So(err, ShouldBeNil)
+			So(os.SameFile(fileInfoA, fileInfoB), ShouldBeFalse)
+		})
+	})
+
+	Convey("Packing | Byte progress", t, func() {
+		source := newTempMocksDir("arc_test_pack_byte_progress_src", true)
+
+		So(ioutil.WriteFile(filepath.Join(source, "a.txt"), bytes.Repeat([]byte("a"), 3*1024*1024), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "b.txt"), bytes.Repeat([]byte("b"), 1024), 0644), ShouldBeNil)
+
+		for _, f := range []string{"zip", "tar.gz"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_byte_progress.%s", ext))
+
+				completed := make(chan ProgressInfo, 1)
+
+				_ph := ProgressHandler{
+					OnReceived: func(pInfo *ProgressInfo) {},
+					OnError:    func(err error, pInfo *ProgressInfo) {},
+					OnCompleted: func(pInfo *ProgressInfo) {
+						completed <- *pInfo
+					},
+				}
+
+				err := StartPacking(&ArchiveMeta{Filename: filename}, &ArchivePack{FileList: []string{source}}, &_ph)
+
+				So(err, ShouldBeNil)
+
+				pInfo := <-completed
+
+				So(pInfo.TotalBytes, ShouldEqual, 3*1024*1024+1024)
+				So(pInfo.ProcessedBytes, ShouldEqual, pInfo.TotalBytes)
+				So(pInfo.BytesPerSecond, ShouldBeGreaterThan, 0)
+				So(pInfo.EstimatedTimeRemaining, ShouldEqual, 0)
+			})
+		}
+
+		Convey("zip | workers | It should count the bytes read by the workers", func() {
+			filename := newTempMocksAsset("arc_test_pack_byte_progress_workers.zip")
+
+			completed := make(chan ProgressInfo, 1)
+
+			_ph := ProgressHandler{
+				OnReceived: func(pInfo *ProgressInfo) {},
+				OnError:    func(err error, pInfo *ProgressInfo) {},
+				OnCompleted: func(pInfo *ProgressInfo) {
+					completed <- *pInfo
+				},
+			}
+
+			err := StartPacking(&ArchiveMeta{Filename: filename}, &ArchivePack{FileList: []string{source}, Workers: 2}, &_ph)
+
+			So(err, ShouldBeNil)
+
+			pInfo := <-completed
+
+			So(pInfo.TotalBytes, ShouldEqual, 3*1024*1024+1024)
+			So(pInfo.ProcessedBytes, ShouldEqual, pInfo.TotalBytes)
+			So(pInfo.BytesPerSecond, ShouldBeGreaterThan, 0)
+		})
+	})
+
+	Convey("Packing | Cancellation", t, func() {
+		source := newTempMocksDir("arc_test_pack_cancellation_src", true)
+
+		So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "b.txt"), []byte("b"), 0644), ShouldBeNil)
+
+		for _, f := range []string{"zip", "tar", "tar.gz"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should remove the partial archive", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_cancellation.%s", ext))
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// the files are filtered right before the entries are written
+				_packObj := &ArchivePack{
+					FileList: []string{source},
+					FilterFunc: func(relativeFilePath string, fileInfo os.FileInfo) bool {
+						cancel()
+
+						return true
+					},
+				}
+
+				err := StartPackingContext(ctx, &ArchiveMeta{Filename: filename}, _packObj, &ph)
+
+				So(errors.Is(err, ErrCancelled), ShouldBeTrue)
+				So(errors.Is(err, context.Canceled), ShouldBeTrue)
+				So(FileExists(filename), ShouldBeFalse)
+			})
+		}
+
+		Convey("zip | workers | It should remove the partial archive", func() {
+			filename := newTempMocksAsset("arc_test_pack_cancellation_workers.zip")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			_packObj := &ArchivePack{
+				FileList: []string{source},
+				Workers:  4,
+				FilterFunc: func(relativeFilePath string, fileInfo os.FileInfo) bool {
+					cancel()
+
+					return true
+				},
+			}
+
+			err := StartPackingContext(ctx, &ArchiveMeta{Filename: filename}, _packObj, &ph)
+
+			So(errors.Is(err, ErrCancelled), ShouldBeTrue)
+			So(FileExists(filename), ShouldBeFalse)
+		})
+
+		Convey("tar | It should leave the updated archive as it was", func() {
+			filename := newTempMocksAsset("arc_test_pack_cancellation_update.tar")
+
+			_metaObj := &ArchiveMeta{Filename: filename}
+
+			err := StartPacking(_metaObj, &ArchivePack{FileList: []string{filepath.Join(source, "a.txt")}}, &ph)
+
+			So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			_packObj := &ArchivePack{
+				FileList:       []string{filepath.Join(source, "b.txt")},
+				UpdateExisting: true,
+				FilterFunc: func(relativeFilePath string, fileInfo os.FileInfo) bool {
+					cancel()
+
+					return true
+				},
+			}
+
+			err = StartPackingContext(ctx, _metaObj, _packObj, &ph)
+
+			So(errors.Is(err, ErrCancelled), ShouldBeTrue)
+
+			_testListingPackedArchive(_metaObj, []string{"a.txt"})
+		})
+
+		Convey("Unpacking | It should not leave any file behind", func() {
+			filename := newTempMocksAsset("arc_test_pack_cancellation_unpack.tar.gz")
+
+			_metaObj := &ArchiveMeta{Filename: filename}
+
+			err := StartPacking(_metaObj, &ArchivePack{FileList: []string{source}}, &ph)
+
+			So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_destination := filepath.Join(newTempMocksDir("arc_test_pack_cancellation", true), "out")
+
+			err = StartUnpackingContext(ctx, _metaObj, &ArchiveUnpack{Destination: _destination}, &ph)
+
+			So(errors.Is(err, ErrCancelled), ShouldBeTrue)
+			So(exists(_destination), ShouldBeFalse)
+
+			_, err = GetArchiveFileListContext(ctx, _metaObj, &ArchiveRead{Recursive: true})
+
+			So(errors.Is(err, ErrCancelled), ShouldBeTrue)
+		})
+	})
+
+	Convey("Packing | Atomic creation", t, func() {
+		source := newTempMocksDir("arc_test_pack_atomic_src", true)
+
+		So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0644), ShouldBeNil)
+
+		for _, f := range []string{"zip", "tar.gz"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should keep the existing archive if packing fails", ext), func() {
+				outputDir := newTempMocksDir(fmt.Sprintf("arc_test_pack_atomic_%s", ext), true)
+				filename := filepath.Join(outputDir, fmt.Sprintf("arc_test_pack_atomic.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+
+				err := StartPacking(_metaObj, &ArchivePack{FileList: []string{filepath.Join(source, "a.txt")}}, &ph)
+
+				So(err, ShouldBeNil)
+
+				reader, writer := io.Pipe()
+				So(writer.CloseWithError(fmt.Errorf("read failed")), ShouldBeNil)
+
+				_packObj := &ArchivePack{
+					FileList:     []string{filepath.Join(source, "a.txt")},
+					VirtualFiles: []VirtualFile{{Name: "b.txt", Reader: reader, Size: 10}},
+				}
+
+				err = StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldNotBeNil)
+
+				files, err := ioutil.ReadDir(outputDir)
+
+				So(err, ShouldBeNil)
+				So(files, ShouldHaveLength, 1)
+
+				_testListingPackedArchive(_metaObj, []string{"a.txt"})
+			})
+		}
+	})
+
+	Convey("Unpacking | Unsafe paths", t, func() {
+		entries := []string{"../evil.txt", "a/../../evil.txt", "/evil.txt", "C:/evil.txt", "..\\evil.txt"}
+
+		for _, e := range entries {
+			entry := e
+
+			Convey(fmt.Sprintf("%s | It should refuse the entry", entry), func() {
+				_destination := filepath.Join(newTempMocksDir("arc_test_unpack_unsafe_paths", true), "out")
+
+				tarFilename := newTempMocksAsset("arc_test_unpack_unsafe_paths.tar")
+
+				tarFile, err := os.Create(tarFilename)
+				So(err, ShouldBeNil)
+
+				tarWriter := tar.NewWriter(tarFile)
+				So(tarWriter.WriteHeader(&tar.Header{Name: entry, Mode: 0644, Size: 4, Typeflag: tar.TypeReg}), ShouldBeNil)
+				_, err = tarWriter.Write([]byte("evil"))
+				So(err, ShouldBeNil)
+				So(tarWriter.Close(), ShouldBeNil)
+				So(tarFile.Close(), ShouldBeNil)
+
+				zipFilename := newTempMocksAsset("arc_test_unpack_unsafe_paths.zip")
+
+				zipFile, err := os.Create(zipFilename)
+				So(err, ShouldBeNil)
+
+				zipWriter := zip.NewWriter(zipFile)
+				writer, err := zipWriter.Create(entry)
+				So(err, ShouldBeNil)
+				_, err = writer.Write([]byte("evil"))
+				So(err, ShouldBeNil)
+				So(zipWriter.Close(), ShouldBeNil)
+				So(zipFile.Close(), ShouldBeNil)
+
+				for _, filename := range []string{tarFilename, zipFilename} {
+					err := StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination}, &ph)
+
+					var unsafePathErr *UnsafePathError
+
+					So(errors.As(err, &unsafePathErr), ShouldBeTrue)
+					So(unsafePathErr.Entry, ShouldEqual, entry)
+					So(FileExists(filepath.Join(filepath.Dir(_destination), "evil.txt")), ShouldBeFalse)
+				}
+			})
+		}
+
+		Convey("after a safe entry | It should remove the files written so far", func() {
+			_destination := filepath.Join(newTempMocksDir("arc_test_unpack_unsafe_paths_cleanup", true), "out")
+
+			filename := newTempMocksAsset("arc_test_unpack_unsafe_paths_cleanup.tar")
+
+			tarFile, err := os.Create(filename)
+			So(err, ShouldBeNil)
+
+			tarWriter := tar.NewWriter(tarFile)
+			So(tarWriter.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}), ShouldBeNil)
+			_, err = tarWriter.Write([]byte("safe"))
+			So(err, ShouldBeNil)
+			So(tarWriter.WriteHeader(&tar.Header{Name: "../evil.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}), ShouldBeNil)
+			_, err = tarWriter.Write([]byte("evil"))
+			So(err, ShouldBeNil)
+			So(tarWriter.Close(), ShouldBeNil)
+			So(tarFile.Close(), ShouldBeNil)
+
+			err = StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination}, &ph)
+
+			var unsafePathErr *UnsafePathError
+
+			So(errors.As(err, &unsafePathErr), ShouldBeTrue)
+			So(exists(_destination), ShouldBeFalse)
+		})
+
+		Convey("symlink | It should not write through a symlink in the destination", func() {
+			_destination := filepath.Join(newTempMocksDir("arc_test_unpack_unsafe_paths_symlink", true), "out")
+			outside := newTempMocksDir("arc_test_unpack_unsafe_paths_outside", true)
+
+			So(os.MkdirAll(_destination, 0755), ShouldBeNil)
+			So(os.Symlink(outside, filepath.Join(_destination, "a")), ShouldBeNil)
+
+			filename := newTempMocksAsset("arc_test_unpack_unsafe_paths_symlink.tar")
+
+			tarFile, err := os.Create(filename)
+			So(err, ShouldBeNil)
+
+			tarWriter := tar.NewWriter(tarFile)
+			So(tarWriter.WriteHeader(&tar.Header{Name: "a/evil.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}), ShouldBeNil)
+			_, err = tarWriter.Write([]byte("evil"))
+			So(err, ShouldBeNil)
+			So(tarWriter.Close(), ShouldBeNil)
+			So(tarFile.Close(), ShouldBeNil)
+
+			err = StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination}, &ph)
+
+			var unsafePathErr *UnsafePathError
+
+			So(errors.As(err, &unsafePathErr), ShouldBeTrue)
+			So(unsafePathErr.Entry, ShouldEqual, "a/evil.txt")
+			So(FileExists(filepath.Join(outside, "evil.txt")), ShouldBeFalse)
+		})
+
+		Convey("symlink target through an earlier symlink | It should refuse the entry", func() {
+			_destination := filepath.Join(newTempMocksDir("arc_test_unpack_unsafe_paths_symlink_chain", true), "out")
+
+			filename := newTempMocksAsset("arc_test_unpack_unsafe_paths_symlink_chain.tar")
+
+			tarFile, err := os.Create(filename)
+			So(err, ShouldBeNil)
+
+			tarWriter := tar.NewWriter(tarFile)
+			So(tarWriter.WriteHeader(&tar.Header{Name: "d", Linkname: ".", Mode: 0777, Typeflag: tar.TypeSymlink}), ShouldBeNil)
+			So(tarWriter.WriteHeader(&tar.Header{Name: "s", Linkname: "d/../evil.txt", Mode: 0777, Typeflag: tar.TypeSymlink}), ShouldBeNil)
+			So(tarWriter.Close(), ShouldBeNil)
+			So(tarFile.Close(), ShouldBeNil)
+
+			err = StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination}, &ph)
+
+			var unsafePathErr *UnsafePathError
+
+			So(errors.As(err, &unsafePathErr), ShouldBeTrue)
+			So(unsafePathErr.Entry, ShouldEqual, "s")
+			So(exists(_destination), ShouldBeFalse)
+		})
+
+		Convey("hard link to a symlink | It should not restore the metadata on the symlink target", func() {
+			_destination := filepath.Join(newTempMocksDir("arc_test_unpack_unsafe_paths_hard_link", true), "out")
+			outside := newTempMocksDir("arc_test_unpack_unsafe_paths_hard_link_outside", true)
+
+			victim := filepath.Join(outside, "victim.txt")
+			So(ioutil.WriteFile(victim, []byte("victim"), 0644), ShouldBeNil)
+
+			victimInfo, err := os.Stat(victim)
+			So(err, ShouldBeNil)
+
+			So(os.MkdirAll(_destination, 0755), ShouldBeNil)
+			So(os.Symlink(victim, filepath.Join(_destination, "a")), ShouldBeNil)
+
+			filename := newTempMocksAsset("arc_test_unpack_unsafe_paths_hard_link.tar")
+
+			tarFile, err := os.Create(filename)
+			So(err, ShouldBeNil)
+
+			modTime := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			tarWriter := tar.NewWriter(tarFile)
+			So(tarWriter.WriteHeader(&tar.Header{Name: "h", Linkname: "a", Mode: 0644, ModTime: modTime, Typeflag: tar.TypeLink}), ShouldBeNil)
+			So(tarWriter.Close(), ShouldBeNil)
+			So(tarFile.Close(), ShouldBeNil)
+
+			err = StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination}, &ph)
+
+			So(err, ShouldBeNil)
+
+			newVictimInfo, err := os.Stat(victim)
+			So(err, ShouldBeNil)
+			So(newVictimInfo.ModTime(), ShouldEqual, victimInfo.ModTime())
+		})
+	})
+
+	Convey("Unpacking | Limits", t, func() {
+		source := newTempMocksDir("arc_test_unpack_limits_src", true)
+
+		So(ioutil.WriteFile(filepath.Join(source, "zeros.bin"), make([]byte, 2*1024*1024), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0644), ShouldBeNil)
+
+		limitsList := map[string]ArchiveLimits{
+			"MaxEntries":          {MaxEntries: 1},
+			"MaxEntrySize":        {MaxEntrySize: 1024},
+			"MaxTotalSize":        {MaxTotalSize: 1024},
+			"MaxCompressionRatio": {MaxCompressionRatio: 10},
+		}
+
+		formats := map[string][]string{
+			"zip":    {source},
+			"tar.gz": {source},
+			"gz":     {filepath.Join(source, "zeros.bin")},
+		}
+
+		for f, l := range formats {
+			ext := f
+			fileList := l
+
+			filename := newTempMocksAsset(fmt.Sprintf("arc_test_unpack_limits.%s", ext))
+
+			err := StartPacking(&ArchiveMeta{Filename: filename}, &ArchivePack{FileList: fileList}, &ph)
+
+			So(err, ShouldBeNil)
+
+			for n, v := range limitsList {
+				limitName := n
+				limits := v
+
+				// a compressed file holds a single entry
+				if ext == "gz" && limitName == "MaxEntries" {
+					continue
+				}
+
+				Convey(fmt.Sprintf("%s | %s | It should refuse the archive", ext, limitName), func() {
+					_destination := filepath.Join(newTempMocksDir("arc_test_unpack_limits", true), "out")
+
+					err := StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination, Limits: limits}, &ph)
+
+					var limitErr *LimitExceededError
+
+					So(errors.As(err, &limitErr), ShouldBeTrue)
+					So(limitErr.Limit, ShouldEqual, limitName)
+					So(exists(_destination), ShouldBeFalse)
+
+					_, err = GetArchiveFileList(&ArchiveMeta{Filename: filename}, &ArchiveRead{Recursive: true, Limits: limits})
+
+					So(errors.As(err, &limitErr), ShouldBeTrue)
+					So(limitErr.Limit, ShouldEqual, limitName)
+				})
+			}
+
+			Convey(fmt.Sprintf("%s | It should unpack the archive within the limits", ext), func() {
+				_destination := newTempMocksDir("arc_test_unpack_limits", true)
+
+				limits := ArchiveLimits{MaxEntries: 10, MaxEntrySize: 4 * 1024 * 1024, MaxTotalSize: 4 * 1024 * 1024, MaxCompressionRatio: 10000}
+
+				err := StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination, Limits: limits}, &ph)
+
+				So(err, ShouldBeNil)
+			})
+		}
+
+		Convey("zip (encrypted) | It should check the password against the limits", func() {
+			limits := ArchiveLimits{MaxEntrySize: 1024}
+
+			filename := newTempMocksAsset("arc_test_unpack_limits_encrypted.zip")
+			_metaObj := &ArchiveMeta{Filename: filename, Password: "1234567"}
+
+			err := StartPacking(_metaObj, &ArchivePack{FileList: []string{filepath.Join(source, "zeros.bin")}}, &ph)
+			So(err, ShouldBeNil)
+
+			arcSource, err := openArchiveSource(_metaObj)
+			So(err, ShouldBeNil)
+
+			_, err = isArchiveEncrypted(context.Background(), _metaObj, arcSource, limits)
+			arcSource.close()
+
+			var limitErr *LimitExceededError
+
+			So(errors.As(err, &limitErr), ShouldBeTrue)
+			So(limitErr.Limit, ShouldEqual, "MaxEntrySize")
+
+			// the password is checked against the smallest entry
+			filename = newTempMocksAsset("arc_test_unpack_limits_encrypted_dir.zip")
+			_metaObj = &ArchiveMeta{Filename: filename, Password: "1234567"}
+
+			err = StartPacking(_metaObj, &ArchivePack{FileList: []string{source}}, &ph)
+			So(err, ShouldBeNil)
+
+			arcSource, err = openArchiveSource(_metaObj)
+			So(err, ShouldBeNil)
+
+			result, err := isArchiveEncrypted(context.Background(), _metaObj, arcSource, limits)
+			arcSource.close()
+
+			So(err, ShouldBeNil)
+			So(result.IsEncrypted, ShouldBeTrue)
+			So(result.IsValidPassword, ShouldBeTrue)
+		})
+	})
+
+	Convey("Unpacking | Streaming - Tar", t, func() {
+		source := newTempMocksDir("arc_test_unpack_streaming_src", true)
+
+		size := 64 * 1024 * 1024
+		So(ioutil.WriteFile(filepath.Join(source, "large.bin"), bytes.Repeat([]byte("onearchiver"), size/11), 0644), ShouldBeNil)
+
+		for _, f := range []string{"tar", "tar.gz"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not hold the entries in the memory", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_unpack_streaming.%s", ext))
+
+				err := StartPacking(&ArchiveMeta{Filename: filename}, &ArchivePack{FileList: []string{source}}, &ph)
+
+				So(err, ShouldBeNil)
+
+				_destination := newTempMocksDir("arc_test_unpack_streaming", true)
+
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+
+				err = StartUnpacking(&ArchiveMeta{Filename: filename}, &ArchiveUnpack{Destination: _destination}, &ph)
+
+				runtime.ReadMemStats(&after)
+
+				So(err, ShouldBeNil)
+				So(after.TotalAlloc-before.TotalAlloc, ShouldBeLessThan, uint64(size/4))
+
+				fileInfo, err := os.Stat(filepath.Join(_destination, "arc_test_unpack_streaming_src", "large.bin"))
+
+				So(err, ShouldBeNil)
+				So(fileInfo.Size(), ShouldEqual, size/11*11)
+			})
+		}
+	})
+
+	Convey("Packing | Plan", t, func() {
+		source := newTempMocksDir("arc_test_pack_plan_src", true)
+
+		So(os.MkdirAll(filepath.Join(source, "build"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, ".gitignore"), []byte("build/\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("aaa"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "b.log"), []byte("b"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "big.txt"), []byte(strings.Repeat("b", 100)), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "build", "out.txt"), []byte("out"), 0644), ShouldBeNil)
+
+		filename := newTempMocksAsset("arc_test_pack_plan.zip")
+
+		_metaObj := &ArchiveMeta{Filename: filename, GitIgnorePattern: []string{"*.log"}}
+		_packObj := &ArchivePack{
+			FileList:        []string{source},
+			IgnoreFileNames: DefaultIgnoreFileNames,
+			MaxSize:         50,
+		}
+
+		plan, err := PlanPacking(_metaObj, _packObj)
+
+		So(err, ShouldBeNil)
+		So(FileExists(filename), ShouldBeFalse)
+
+		var archivePaths []string
+		for _, entry := range plan.Entries {
+			archivePaths = append(archivePaths, entry.ArchivePath)
+		}
+
+		So(archivePaths, ShouldResemble, []string{"arc_test_pack_plan_src/", "arc_test_pack_plan_src/.gitignore", "arc_test_pack_plan_src/a.txt"})
+		So(plan.TotalSize, ShouldEqual, 10)
+
+		reasons := make(map[string]string)
+		for _, skipped := range plan.Skipped {
+			reasons[filepath.Base(skipped.Path)] = skipped.Reason
+		}
+
+		So(reasons["b.log"], ShouldEqual, `ignore pattern "*.log"`)
+		So(reasons["build"], ShouldEqual, fmt.Sprintf("%s:1:build/", filepath.Join(source, ".gitignore")))
+		So(reasons["big.txt"], ShouldEqual, "max size filter")
+
+		Convey("Unpacking | Plan", func() {
+			err := StartPacking(_metaObj, &ArchivePack{FileList: []string{source}}, &ph)
+
+			So(err, ShouldBeNil)
+
+			_destination := newTempMocksDir("arc_test_pack_plan", true)
+
+			So(os.MkdirAll(filepath.Join(_destination, "arc_test_pack_plan_src", "big.txt"), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(_destination, "arc_test_pack_plan_src", "a.txt"), []byte("old"), 0644), ShouldBeNil)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:    []string{"arc_test_pack_plan_src/a.txt", "arc_test_pack_plan_src/big.txt"},
+				Destination: _destination,
+			}
+
+			plan, err := PlanUnpacking(&ArchiveMeta{Filename: filename}, unpackObj)
+
+			So(err, ShouldBeNil)
+			So(plan.Entries, ShouldHaveLength, 2)
+			So(plan.Entries[0].ArchivePath, ShouldEqual, "arc_test_pack_plan_src/a.txt")
+			So(plan.Entries[0].Overwrite, ShouldBeTrue)
+			So(plan.Entries[1].ArchivePath, ShouldEqual, "arc_test_pack_plan_src/big.txt")
+			So(plan.Entries[1].Conflict, ShouldNotBeEmpty)
+			So(plan.TotalSize, ShouldEqual, 103)
+
+			contents, err := ioutil.ReadFile(filepath.Join(_destination, "arc_test_pack_plan_src", "a.txt"))
+
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "old")
+		})
+	})
+
+	Convey("Packing | Ignore files", t, func() {
+		source := newTempMocksDir("arc_test_pack_ignore_files_src", true)
+
+		So(os.MkdirAll(filepath.Join(source, "a", "b"), 0755), ShouldBeNil)
+		So(os.MkdirAll(filepath.Join(source, "build"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, ".gitignore"), []byte("build/\n*.log\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "a", ".archiveignore"), []byte("!debug.log\n/x.txt\n"), 0644), ShouldBeNil)
+
+		for _, name := range []string{"b.log", "build/out.txt", "a/debug.log", "a/x.txt", "a/b/x.txt", "a/b/c.log"} {
+			So(ioutil.WriteFile(filepath.Join(source, filepath.FromSlash(name)), []byte(name), 0644), ShouldBeNil)
+		}
+
+		for _, f := range []string{"zip", "tar"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_ignore_files.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{
+					FileList:        []string{source},
+					IgnoreFileNames: DefaultIgnoreFileNames,
+				}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				_testListingPackedArchiveUnordered(_metaObj, []string{
+					"arc_test_pack_ignore_files_src/",
+					"arc_test_pack_ignore_files_src/.gitignore",
+					"arc_test_pack_ignore_files_src/a/",
+					"arc_test_pack_ignore_files_src/a/.archiveignore",
+					"arc_test_pack_ignore_files_src/a/debug.log",
+					"arc_test_pack_ignore_files_src/a/b/",
+					"arc_test_pack_ignore_files_src/a/b/x.txt",
+				})
+			})
+		}
+	})
+
+	Convey("Packing | Filters", t, func() {
+		source := newTempMocksDir("arc_test_pack_filters_src", true)
+
+		So(ioutil.WriteFile(filepath.Join(source, "small.txt"), []byte("s"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "big.txt"), []byte(strings.Repeat("b", 100)), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(source, "old.txt"), []byte("o"), 0644), ShouldBeNil)
+
+		oldModTime := time.Now().Add(-48 * time.Hour)
+
+		So(os.Chtimes(filepath.Join(source, "old.txt"), oldModTime, oldModTime), ShouldBeNil)
+
+		for _, f := range []string{"zip", "tar.gz"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | Size", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_filters_size.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{FileList: []string{source}, MinSize: 1, MaxSize: 50}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				_testListingPackedArchive(_metaObj, []string{"arc_test_pack_filters_src/", "arc_test_pack_filters_src/old.txt", "arc_test_pack_filters_src/small.txt"})
+			})
+
+			Convey(fmt.Sprintf("%s | Mod time", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_filters_time.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{FileList: []string{source}, ModifiedAfter: time.Now().Add(-24 * time.Hour)}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				_testListingPackedArchive(_metaObj, []string{"arc_test_pack_filters_src/", "arc_test_pack_filters_src/big.txt", "arc_test_pack_filters_src/small.txt"})
+			})
+
+			Convey(fmt.Sprintf("%s | File types and filter func", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_filters_func.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{
+					FileList:  []string{source},
+					FileTypes: []FileType{FileTypeRegular},
+					FilterFunc: func(relativeFilePath string, fileInfo os.FileInfo) bool {
+						return relativeFilePath != "arc_test_pack_filters_src/big.txt"
+					},
+				}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				_testListingPackedArchive(_metaObj, []string{"arc_test_pack_filters_src/old.txt", "arc_test_pack_filters_src/small.txt"})
+			})
+
+			Convey(fmt.Sprintf("%s | Filter func with an archive prefix", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_filters_func_prefix.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{
+					FileList:      []string{source},
+					FileTypes:     []FileType{FileTypeRegular},
+					ArchivePrefix: "release",
+					FilterFunc: func(relativeFilePath string, fileInfo os.FileInfo) bool {
+						return relativeFilePath != "release/arc_test_pack_filters_src/big.txt"
+					},
+				}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				_testListingPackedArchiveUnordered(_metaObj, []string{"release/", "release/arc_test_pack_filters_src/old.txt", "release/arc_test_pack_filters_src/small.txt"})
+			})
+		}
+	})
+
+	Convey("Packing | Comments - ZIP", t, func() {
+		for _, w := range []int{0, 2} {
+			workers := w
+
+			Convey(fmt.Sprintf("workers=%d | It should not throw an error", workers), func() {
+				filename := newTempMocksAsset("arc_test_pack_comments.zip")
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{
+					FileList:      []string{getTestMocksAsset("mock_dir1")},
+					Workers:       workers,
+					Comment:       "build 42",
+					EntryComments: map[string]string{"mock_dir1/a.txt": "entry a", "mock_dir1/1/": "dir 1"},
+				}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				metadata, err := GetArchiveMetadata(_metaObj)
+
+				So(err, ShouldBeNil)
+				So(metadata.Comment, ShouldEqual, "build 42")
+
+				result, err := GetArchiveFileList(_metaObj, &ArchiveRead{Recursive: true})
+
+				So(err, ShouldBeNil)
+
+				comments := make(map[string]string)
+				for _, item := range result {
+					comments[item.FullPath] = item.Comment
+				}
+
+				So(comments["mock_dir1/a.txt"], ShouldEqual, "entry a")
+				So(comments["mock_dir1/1/"], ShouldEqual, "dir 1")
+				So(comments["mock_dir1/1/a.txt"], ShouldEqual, "")
+
+				Convey("Update existing | the comment should be kept", func() {
+					_packObj := &ArchivePack{
+						FileList:       []string{getTestMocksAsset("mock_dir1")},
+						UpdateExisting: true,
+					}
+
+					err := StartPacking(_metaObj, _packObj, &ph)
+
+					So(err, ShouldBeNil)
+
+					metadata, err := GetArchiveMetadata(_metaObj)
+
+					So(err, ShouldBeNil)
+					So(metadata.Comment, ShouldEqual, "build 42")
+				})
+
+				Convey("Update existing | the entry comments should be set on the kept entries", func() {
+					_packObj := &ArchivePack{
+						FileList:       []string{getTestMocksAsset("mock_dir1")},
+						UpdateExisting: true,
+						EntryComments:  map[string]string{"mock_dir1/1/a.txt": "entry 1/a"},
+					}
+
+					err := StartPacking(_metaObj, _packObj, &ph)
+
+					So(err, ShouldBeNil)
+
+					result, err := GetArchiveFileList(_metaObj, &ArchiveRead{Recursive: true})
+
+					So(err, ShouldBeNil)
+
+					comments := make(map[string]string)
+					for _, item := range result {
+						comments[item.FullPath] = item.Comment
+					}
+
+					So(comments["mock_dir1/1/a.txt"], ShouldEqual, "entry 1/a")
+					So(comments["mock_dir1/a.txt"], ShouldEqual, "entry a")
+				})
+			})
+		}
+
+		Convey("Encrypted | It should throw an error", func() {
+			filename := newTempMocksAsset("arc_test_pack_comments_encrypted.zip")
+
+			_metaObj := &ArchiveMeta{Filename: filename, Password: "1234567"}
+			_packObj := &ArchivePack{
+				FileList: []string{getTestMocksAsset("mock_dir1")},
+				Comment:  "build 42",
+			}
+
+			err := StartPacking(_metaObj, _packObj, &ph)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Packing | Encrypted envelope - Tar", t, func() {
+		for _, f := range []string{"tar", "tar.zst", "gz"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_envelope.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename, Password: "1234567"}
+				_packObj := &ArchivePack{FileList: []string{getTestMocksAsset("mock_dir1/a.txt")}}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				contents, err := ioutil.ReadFile(filename)
+
+				So(err, ShouldBeNil)
+				So(string(contents), ShouldStartWith, "age-encryption.org/v1\n")
+
+				result, err := IsArchiveEncrypted(_metaObj)
+
+				So(err, ShouldBeNil)
+				So(result.IsEncrypted, ShouldBeTrue)
+				So(result.IsValidPassword, ShouldBeTrue)
+
+				_, err = GetArchiveFileList(&ArchiveMeta{Filename: filename, Password: "wrong"}, &ArchiveRead{})
+
+				So(err, ShouldNotBeNil)
+
+				_, err = GetArchiveFileList(&ArchiveMeta{Filename: filename}, &ArchiveRead{})
+
+				So(err, ShouldNotBeNil)
+
+				files, err := GetArchiveFileList(_metaObj, &ArchiveRead{})
+
+				So(err, ShouldBeNil)
+				So(len(files), ShouldEqual, 1)
+
+				_destination := newTempMocksDir("arc_test_pack_envelope", true)
+
+				err = StartUnpacking(_metaObj, &ArchiveUnpack{Destination: _destination}, &ph)
+
+				So(err, ShouldBeNil)
+				So(FileExists(filepath.Join(_destination, files[0].FullPath)), ShouldBeTrue)
+			})
+		}
+
+		Convey("Recipients | It should not throw an error", func() {
+			filename := newTempMocksAsset("arc_test_pack_envelope_recipients.tar.gz")
+
+			identity, err := age.GenerateX25519Identity()
+
+			So(err, ShouldBeNil)
+
+			_packObj := &ArchivePack{FileList: []string{getTestMocksAsset("mock_dir1/a.txt")}}
+
+			err = StartPacking(&ArchiveMeta{Filename: filename, Recipients: []string{identity.Recipient().String()}}, _packObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			_testListingPackedArchive(&ArchiveMeta{Filename: filename, Identities: []string{identity.String()}}, []string{"a.txt"})
+		})
+
+		Convey("Recipients with zip | It should throw an error", func() {
+			filename := newTempMocksAsset("arc_test_pack_envelope_recipients.zip")
+
+			identity, err := age.GenerateX25519Identity()
+
+			So(err, ShouldBeNil)
+
+			_metaObj := &ArchiveMeta{Filename: filename, Recipients: []string{identity.Recipient().String()}}
+
+			err = StartPacking(_metaObj, &ArchivePack{FileList: []string{getTestMocksAsset("mock_dir1/a.txt")}}, &ph)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Packing | Sparse files - Tar", t, func() {
+		filename := newTempMocksAsset("arc_test_pack_sparse.tar")
+		source := newTempMocksDir("arc_test_pack_sparse_src", true)
+
+		sparseFilename := filepath.Join(source, "disk.img")
+		sparseFile, err := os.Create(sparseFilename)
+
+		So(err, ShouldBeNil)
+		So(sparseFile.Truncate(4*1024*1024), ShouldBeNil)
+
+		_, err = sparseFile.WriteAt([]byte("sparse"), 1024*1024)
+
+		So(err, ShouldBeNil)
+		So(sparseFile.Close(), ShouldBeNil)
+
+		_metaObj := &ArchiveMeta{Filename: filename}
+		_packObj := &ArchivePack{
+			FileList:          []string{source},
+			DetectSparseFiles: true,
+		}
+
+		err = StartPacking(_metaObj, _packObj, &ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("Tar headers", func() {
+			file, err := os.Open(filename)
+
+			So(err, ShouldBeNil)
+
+			defer file.Close()
+
+			tarReader := tar.NewReader(file)
+
+			var header *tar.Header
+			for {
+				header, err = tarReader.Next()
+
+				So(err, ShouldBeNil)
+
+				if header.Name == "arc_test_pack_sparse_src/disk.img" {
+					break
+				}
+			}
+
+			So(header.Size, ShouldEqual, 4*1024*1024)
+
+			contents, err := ioutil.ReadAll(tarReader)
+
+			So(err, ShouldBeNil)
+			So(len(contents), ShouldEqual, 4*1024*1024)
+			So(string(contents[1024*1024:1024*1024+6]), ShouldEqual, "sparse")
+
+			// the holes are only detected on linux
+			if runtime.GOOS == "linux" {
+				fileInfo, err := file.Stat()
+
+				So(err, ShouldBeNil)
+				So(fileInfo.Size(), ShouldBeLessThan, 1024*1024)
+			}
+		})
+
+		Convey("Tar headers | the stdlib reader should read the data regions and the holes back", func() {
+			file, err := os.Open(filename)
+
+			So(err, ShouldBeNil)
+
+			defer file.Close()
+
+			tarReader := tar.NewReader(file)
+
+			var header *tar.Header
+			for {
+				header, err = tarReader.Next()
+
+				So(err, ShouldBeNil)
+
+				if header.Name == "arc_test_pack_sparse_src/disk.img" {
+					break
+				}
+			}
+
+			// the holes are only detected on linux
+			if runtime.GOOS == "linux" {
+				So(header.PAXRecords["GNU.sparse.major"], ShouldEqual, "1")
+				So(header.PAXRecords["GNU.sparse.minor"], ShouldEqual, "0")
+				So(header.PAXRecords["GNU.sparse.realsize"], ShouldEqual, "4194304")
+			}
+
+			contents, err := ioutil.ReadAll(tarReader)
+
+			So(err, ShouldBeNil)
+
+			expected, err := ioutil.ReadFile(sparseFilename)
+
+			So(err, ShouldBeNil)
+			So(bytes.Equal(contents, expected), ShouldBeTrue)
+		})
+
+		Convey("Unpack Packed Archive files", func() {
+			_destination := newTempMocksDir("arc_test_pack_sparse", true)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:    []string{},
+				Destination: _destination,
+			}
+
+			err := StartUnpacking(_metaObj, unpackObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(filepath.Join(_destination, "arc_test_pack_sparse_src/disk.img"))
+
+			So(err, ShouldBeNil)
+			So(len(contents), ShouldEqual, 4*1024*1024)
+			So(string(contents[1024*1024:1024*1024+6]), ShouldEqual, "sparse")
+
+			// the holes survive unpacking: the file takes up fewer blocks than its size
+			if runtime.GOOS == "linux" {
+				file, err := os.Open(filepath.Join(_destination, "arc_test_pack_sparse_src/disk.img"))
+
+				So(err, ShouldBeNil)
+
+				defer file.Close()
+
+				fileInfo, err := file.Stat()
+
+				So(err, ShouldBeNil)
+
+				regions, isSparse := sparseDataRegions(file, fileInfo)
+
+				So(isSparse, ShouldBeTrue)
+				So(regions, ShouldNotBeEmpty)
+			}
+		})
+	})
+
+	Convey("Packing | Update existing", t, func() {
+		for _, f := range []string{"zip", "tar", "tar.gz", "tar.xz"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_update.%s", ext))
+				source := newTempMocksDir("arc_test_pack_update_src", true)
+
+				So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0644), ShouldBeNil)
+				So(ioutil.WriteFile(filepath.Join(source, "b.txt"), []byte("b"), 0644), ShouldBeNil)
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+
+				err := StartPacking(_metaObj, &ArchivePack{FileList: []string{source}}, &ph)
+
+				So(err, ShouldBeNil)
+
+				_listObj := &ArchiveRead{Recursive: true, OrderBy: OrderByFullPath, OrderDir: OrderDirAsc}
+
+				Convey("New files | It should not throw an error", func() {
+					So(ioutil.WriteFile(filepath.Join(source, "c.txt"), []byte("c"), 0644), ShouldBeNil)
+
+					err := StartPacking(_metaObj, &ArchivePack{FileList: []string{source}, UpdateExisting: true}, &ph)
+
+					So(err, ShouldBeNil)
+
+					result, err := GetArchiveFileList(_metaObj, _listObj)
+
+					So(err, ShouldBeNil)
+
+					var itemsArr []string
+
+					for _, item := range result {
+						itemsArr = append(itemsArr, item.FullPath)
+					}
+
+					So(itemsArr, ShouldResemble, []string{"arc_test_pack_update_src/", "arc_test_pack_update_src/a.txt", "arc_test_pack_update_src/b.txt", "arc_test_pack_update_src/c.txt"})
+				})
+
+				Convey("Changed files | It should not throw an error", func() {
+					So(ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("aaaa"), 0644), ShouldBeNil)
+
+					err := StartPacking(_metaObj, &ArchivePack{FileList: []string{source}, UpdateExisting: true}, &ph)
+
+					So(err, ShouldBeNil)
+
+					result, err := GetArchiveFileList(_metaObj, _listObj)
+
+					So(err, ShouldBeNil)
+
+					var itemsArr []string
+
+					for _, item := range result {
+						itemsArr = append(itemsArr, item.FullPath)
+
+						if item.Name == "a.txt" {
+							So(item.Size, ShouldEqual, 4)
+						}
+					}
+
+					So(itemsArr, ShouldResemble, []string{"arc_test_pack_update_src/", "arc_test_pack_update_src/a.txt", "arc_test_pack_update_src/b.txt"})
+				})
+			})
+		}
+	})
+	Convey("Packing | Parallel - ZIP", t, func() {
+		filename := newTempMocksAsset("arc_test_pack_parallel.zip")
+
+		_metaObj := &ArchiveMeta{Filename: filename}
+		_packObj := &ArchivePack{
+			FileList: []string{getTestMocksAsset("mock_dir1")},
+			Workers:  4,
+		}
+
+		err := StartPacking(_metaObj, _packObj, &ph)
+
+		So(err, ShouldBeNil)
+
+		Convey("List Packed Archive files", func() {
+			assertionArr := []string{"mock_dir1/", "mock_dir1/a.txt", "mock_dir1/1/", "mock_dir1/1/a.txt", "mock_dir1/2/", "mock_dir1/2/b.txt", "mock_dir1/3/", "mock_dir1/3/b.txt", "mock_dir1/3/2/", "mock_dir1/3/2/b.txt"}
+
+			_testListingPackedArchive(_metaObj, assertionArr)
+		})
+
+		Convey("Unpack Packed Archive files", func() {
+			_destination := newTempMocksDir("arc_test_pack_parallel", true)
+
+			unpackObj := &ArchiveUnpack{
+				FileList:    []string{},
+				Destination: _destination,
+			}
+
+			err := StartUnpacking(_metaObj, unpackObj, &ph)
+
+			So(err, ShouldBeNil)
+
+			expected, err := ioutil.ReadFile(getTestMocksAsset("mock_dir1/3/2/b.txt"))
+
+			So(err, ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(filepath.Join(_destination, "mock_dir1/3/2/b.txt"))
+
+			So(err, ShouldBeNil)
+			So(contents, ShouldResemble, expected)
+		})
+	})
+
+	Convey("Packing | Split volumes", t, func() {
+		for _, f := range []string{"zip", "tar"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_volumes.%s", ext))
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{
+					FileList:   []string{getTestMocksAsset("mock_dir1")},
+					VolumeSize: 256,
+				}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				archiveFilename, volumes, err := archiveVolumes(filename)
+
+				So(err, ShouldBeNil)
+				So(archiveFilename, ShouldEqual, filename)
+				So(len(volumes), ShouldBeGreaterThan, 1)
+
+				// the zip file is a pkzip split set, the last volume of which is the zip file itself
+				firstVolume := fmt.Sprintf("%s.001", filename)
+				if ext == "zip" {
+					firstVolume = fmt.Sprintf("%s.z01", strings.TrimSuffix(filename, ".zip"))
+
+					So(volumes[len(volumes)-1], ShouldEqual, filename)
+				} else {
+					So(FileExists(filename), ShouldBeFalse)
+				}
+
+				So(volumes[0], ShouldEqual, firstVolume)
+
+				for _, volume := range volumes[:len(volumes)-1] {
+					fileInfo, err := os.Stat(volume)
+
+					So(err, ShouldBeNil)
+
+					// the zip headers and records are never split across two volumes
+					if ext == "zip" {
+						So(fileInfo.Size(), ShouldBeLessThanOrEqualTo, 256)
+					} else {
+						So(fileInfo.Size(), ShouldEqual, 256)
+					}
+				}
+
+				assertionArr := []string{"mock_dir1/", "mock_dir1/a.txt", "mock_dir1/1/", "mock_dir1/1/a.txt", "mock_dir1/2/", "mock_dir1/2/b.txt", "mock_dir1/3/", "mock_dir1/3/b.txt", "mock_dir1/3/2/", "mock_dir1/3/2/b.txt"}
+
+				Convey("List Packed Archive files", func() {
+					_testListingPackedArchive(_metaObj, assertionArr)
+				})
+
+				Convey("List Packed Archive files | first volume", func() {
+					_testListingPackedArchive(&ArchiveMeta{Filename: volumes[0]}, assertionArr)
+				})
+
+				Convey("List Packed Archive files | last volume", func() {
+					_testListingPackedArchive(&ArchiveMeta{Filename: volumes[len(volumes)-1]}, assertionArr)
+				})
+
+				Convey("It should refuse an incomplete set of volumes", func() {
+					So(os.Remove(volumes[len(volumes)-2]), ShouldBeNil)
+
+					_, err := GetArchiveFileList(&ArchiveMeta{Filename: volumes[0]}, &ArchiveRead{Recursive: true})
+
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("It should leave the stray volumes next to a regular archive alone", func() {
+					err := StartPacking(_metaObj, &ArchivePack{FileList: []string{getTestMocksAsset("mock_dir1")}}, &ph)
+
+					So(err, ShouldBeNil)
+
+					// a stray volume which doesn't belong to the archive
+					So(ioutil.WriteFile(firstVolume, []byte("stray"), 0644), ShouldBeNil)
+
+					_testListingPackedArchive(_metaObj, assertionArr)
+				})
+
+				Convey("Unpack Packed Archive files", func() {
+					_destination := newTempMocksDir("arc_test_pack_volumes", true)
+
+					unpackObj := &ArchiveUnpack{
+						FileList:    []string{},
+						Destination: _destination,
+					}
+
+					err := StartUnpacking(_metaObj, unpackObj, &ph)
+
+					So(err, ShouldBeNil)
+
+					expected, err := ioutil.ReadFile(getTestMocksAsset("mock_dir1/3/2/b.txt"))
+
+					So(err, ShouldBeNil)
+
+					contents, err := ioutil.ReadFile(filepath.Join(_destination, "mock_dir1/3/2/b.txt"))
+
+					So(err, ShouldBeNil)
+					So(contents, ShouldResemble, expected)
+				})
+			})
+		}
+	})
+
+	Convey("Packing | Compressed file", t, func() {
+		for _, f := range []string{"gz", "bz2", "br", "lz4", "sz", "xz", "zst"} {
+			ext := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", ext), func() {
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_compressed.txt.%s", ext))
+				source := getTestMocksAsset("mock_dir1/a.txt")
+
+				_metaObj := &ArchiveMeta{Filename: filename}
+				_packObj := &ArchivePack{FileList: []string{source}}
+
+				err := StartPacking(_metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				Convey("List Packed Archive files", func() {
+					_testListingPackedArchive(_metaObj, []string{"arc_test_pack_compressed.txt"})
+				})
+
+				// gz and xz record the size, the rest of the formats are decompressed
+				Convey("List Packed Archive files | size", func() {
+					fileInfo, err := os.Stat(source)
+
+					So(err, ShouldBeNil)
+
+					files, err := GetArchiveFileList(_metaObj, &ArchiveRead{Recursive: true})
+
+					So(err, ShouldBeNil)
+					So(len(files), ShouldEqual, 1)
+					So(files[0].Size, ShouldEqual, fileInfo.Size())
+				})
+
+				Convey("Unpack Packed Archive files", func() {
+					_destination := newTempMocksDir("arc_test_pack_compressed", true)
+
+					unpackObj := &ArchiveUnpack{
+						FileList:    []string{},
+						Destination: _destination,
+					}
+
+					err := StartUnpacking(_metaObj, unpackObj, &ph)
+
+					So(err, ShouldBeNil)
+
+					expected, err := ioutil.ReadFile(source)
+
+					So(err, ShouldBeNil)
+
+					contents, err := ioutil.ReadFile(filepath.Join(_destination, "arc_test_pack_compressed.txt"))
+
+					So(err, ShouldBeNil)
+					So(contents, ShouldResemble, expected)
+				})
+			})
+		}
+
+		Convey("Multiple files | It should throw an error", func() {
+			filename := newTempMocksAsset("arc_test_pack_compressed_multiple.gz")
+
+			_metaObj := &ArchiveMeta{Filename: filename}
+			_packObj := &ArchivePack{FileList: []string{getTestMocksAsset("mock_dir1")}}
+
+			err := StartPacking(_metaObj, _packObj, &ph)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Packing | Writer", t, func() {
+		for _, f := range []ArchiveFormat{FormatZip, FormatTar, FormatTarGz, FormatTarZstd} {
+			format := f
+
+			Convey(fmt.Sprintf("%s | It should not throw an error", format), func() {
+				var out bytes.Buffer
+
+				_metaObj := &ArchiveMeta{}
+				_packObj := &ArchivePack{
+					FileList: []string{getTestMocksAsset("mock_dir1/a.txt")},
+					VirtualFiles: []VirtualFile{
+						{Name: "notes.txt", Reader: strings.NewReader("notes")},
+					},
+				}
+
+				err := StartPackingToWriter(&out, format, _metaObj, _packObj, &ph)
+
+				So(err, ShouldBeNil)
+
+				filename := newTempMocksAsset(fmt.Sprintf("arc_test_pack_writer.%s", format))
+
+				So(ioutil.WriteFile(filename, out.Bytes(), 0644), ShouldBeNil)
+
+				Convey("List Packed Archive files", func() {
+					_testListingPackedArchive(&ArchiveMeta{Filename: filename}, []string{"a.txt", "notes.txt"})
+				})
+			})
+		}
+
+		Convey("Unsupported format | It should throw an error", func() {
+			var out bytes.Buffer
+
+			err := StartPackingToWriter(&out, ArchiveFormat("rar"), &ArchiveMeta{}, &ArchivePack{}, &ph)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
 }
@@ -1,30 +1,21 @@
 package onearchiver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/ganeshrvel/archiver"
 	"github.com/yeka/zip"
+	"io"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strings"
 )
 
-func isRarArchiveEncrypted(arcValues *archiver.Rar, filename, password string) (bool, error) {
+func isRarArchiveEncrypted(arcValues *archiver.Rar, source *archiveSource, password string) (bool, error) {
 	arcValues.Password = password
 
-	file, err := os.Open(filename)
-	if err != nil {
-		return false, err
-	}
-
-	defer func() {
-		if err := file.Close(); err != nil {
-			fmt.Printf("%v\n", err)
-		}
-	}()
-
-	err = arcValues.Open(file, 0)
+	err := arcValues.Open(source.reader(), 0)
 	if err != nil {
 		return false, err
 	}
@@ -57,8 +48,9 @@ func isRarArchiveEncrypted(arcValues *archiver.Rar, filename, password string) (
 	return false, nil
 }
 
+// the password is checked against the smallest encrypted entry, which is decrypted in full to check its crc (or its hmac, for aes)
+// the entry is read against [ArchiveRead.Limits] and no further than the size in its header
 func (arc zipArchive) isEncrypted() (EncryptedArchiveInfo, error) {
-	_filename := arc.meta.Filename
 	_password := arc.meta.Password
 
 	ai := EncryptedArchiveInfo{
@@ -66,46 +58,74 @@ func (arc zipArchive) isEncrypted() (EncryptedArchiveInfo, error) {
 		IsValidPassword: false,
 	}
 
-	reader, err := zip.OpenReader(_filename)
+	reader, err := zip.NewReader(arc.source, arc.source.size)
 	if err != nil {
 		return ai, err
 	}
 
-	defer func() {
-		if err = reader.Close(); err != nil {
-			fmt.Printf("%v\n", err)
+	var file *zip.File
+
+	for _, f := range reader.File {
+		if !f.IsEncrypted() {
+			continue
 		}
-	}()
 
-	for _, file := range reader.File {
-		if file.IsEncrypted() {
-			ai.IsEncrypted = true
+		// an empty entry has no data to check the password against, hence it's only taken if there is nothing else
+		if file == nil || file.UncompressedSize64 == 0 || (f.UncompressedSize64 > 0 && f.UncompressedSize64 < file.UncompressedSize64) {
+			file = f
+		}
+	}
 
-			file.SetPassword(_password)
+	if file == nil {
+		return ai, nil
+	}
 
-			r, err := file.Open()
-			defer func() {
-				if err = r.Close(); err != nil {
-					fmt.Printf("%v\n", err)
-				}
-			}()
+	ai.IsEncrypted = true
 
-			if err != nil {
-				return ai, err
-			}
+	if err := checkContext(arc.ctx); err != nil {
+		return ai, err
+	}
 
-			_, err = ioutil.ReadAll(r)
-			if err != nil {
-				return ai, nil
-			}
+	limits := newLimitTracker(arc.read.Limits, arc.source.size)
 
-			ai.IsValidPassword = true
+	if err := limits.addEntry(file.Name, int64(file.UncompressedSize64)); err != nil {
+		return ai, err
+	}
 
-			return ai, err
+	file.SetPassword(_password)
+
+	r, err := file.Open()
+	if err != nil {
+		return ai, err
+	}
+
+	defer func() {
+		if err := r.Close(); err != nil {
+			fmt.Printf("%v\n", err)
 		}
+	}()
+
+	// a byte past the size in the header is read to tell the oversized entries apart
+	size := int64(file.UncompressedSize64)
+	n, err := io.Copy(limits.writer(file.Name, ioutil.Discard), io.LimitReader(newContextReader(arc.ctx, r), size+1))
+
+	var limitErr *LimitExceededError
+
+	if isCancelled(err) || errors.As(err, &limitErr) {
+		return ai, err
+	}
+
+	if err != nil {
+		return ai, nil
+	}
+
+	if n > size {
+		return ai, fmt.Errorf("zip entry is larger than the size in its header: %s", file.Name)
 	}
 
-	return ai, err
+	ai.IsValidPassword = true
+
+	return ai, nil
 }
 
 func (arc commonArchive) isEncrypted() (EncryptedArchiveInfo, error) {
@@ -132,7 +152,7 @@ func (arc commonArchive) isEncrypted() (EncryptedArchiveInfo, error) {
 	switch arcValues := arcFileObj.(type) {
 	case *archiver.Rar:
 		// check if the rar file is encrypted
-		r1, err := isRarArchiveEncrypted(arcValues, _filename, "")
+		r1, err := isRarArchiveEncrypted(arcValues, arc.source, "")
 		if err != nil {
 			return ai, err
 		}
@@ -141,7 +161,7 @@ func (arc commonArchive) isEncrypted() (EncryptedArchiveInfo, error) {
 		if r1 {
 			ai.IsEncrypted = true
 
-			r2, err := isRarArchiveEncrypted(arcValues, _filename, _password)
+			r2, err := isRarArchiveEncrypted(arcValues, arc.source, _password)
 			ai.IsValidPassword = !r2
 
 			if err != nil {
@@ -157,30 +177,43 @@ func (arc commonArchive) isEncrypted() (EncryptedArchiveInfo, error) {
 }
 
 func IsArchiveEncrypted(meta *ArchiveMeta) (EncryptedArchiveInfo, error) {
+	return IsArchiveEncryptedContext(context.Background(), meta)
+}
+
+// [IsArchiveEncrypted] which stops once [ctx] is done and returns [ErrCancelled]
+func IsArchiveEncryptedContext(ctx context.Context, meta *ArchiveMeta) (EncryptedArchiveInfo, error) {
 	_meta := *meta
 
+	source, err := openArchiveSource(&_meta)
+	if err != nil {
+		return EncryptedArchiveInfo{}, err
+	}
+
+	defer source.close()
+
+	return isArchiveEncrypted(ctx, &_meta, source, ArchiveLimits{})
+}
+
+// [meta] is expected to be named after [source]; the entries decrypted to check the password are read against [limits]
+func isArchiveEncrypted(ctx context.Context, meta *ArchiveMeta, source *archiveSource, limits ArchiveLimits) (EncryptedArchiveInfo, error) {
 	var utilsObj ArchiveUtils
 
-	ext := filepath.Ext(_meta.Filename)
+	ext := filepath.Ext(meta.Filename)
 
 	switch ext {
 	case ".zip":
-		utilsObj = zipArchive{meta: _meta}
+		utilsObj = zipArchive{meta: *meta, read: ArchiveRead{Limits: limits}, ctx: ctx, source: source}
 
 		break
 
 	case ".rar":
-		utilsObj = commonArchive{meta: _meta}
+		utilsObj = commonArchive{meta: *meta, ctx: ctx, source: source}
 
 		break
 
+	// the tarballs and the compressed files may be wrapped in an encrypted envelope
 	default:
-		ai := EncryptedArchiveInfo{
-			IsEncrypted:     false,
-			IsValidPassword: false,
-		}
-
-		return ai, nil
+		return commonArchive{meta: *meta, ctx: ctx, source: source}.isEnvelopeEncrypted()
 	}
 
 	return utilsObj.isEncrypted()
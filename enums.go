@@ -16,3 +16,36 @@ const (
 	OrderDirDesc ArchiveOrderDir = "desc"
 	OrderDirNone ArchiveOrderDir = "none"
 )
+
+type SymlinkPolicy string
+
+const (
+	SymlinkPolicySkip   SymlinkPolicy = "skip"
+	SymlinkPolicyStore  SymlinkPolicy = "store"
+	SymlinkPolicyFollow SymlinkPolicy = "follow"
+)
+
+type FileType string
+
+const (
+	FileTypeRegular FileType = "regular"
+	FileTypeDir     FileType = "dir"
+	FileTypeSymlink FileType = "symlink"
+
+	// devices, named pipes and sockets
+	FileTypeOther FileType = "other"
+)
+
+type ArchiveFormat string
+
+const (
+	FormatZip       ArchiveFormat = "zip"
+	FormatTar       ArchiveFormat = "tar"
+	FormatTarGz     ArchiveFormat = "tar.gz"
+	FormatTarBz2    ArchiveFormat = "tar.bz2"
+	FormatTarBrotli ArchiveFormat = "tar.br"
+	FormatTarLz4    ArchiveFormat = "tar.lz4"
+	FormatTarSz     ArchiveFormat = "tar.sz"
+	FormatTarXz     ArchiveFormat = "tar.xz"
+	FormatTarZstd   ArchiveFormat = "tar.zst"
+)
@@ -0,0 +1,172 @@
+package onearchiver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"io"
+)
+
+// checks whether the tarball is to be wrapped in an encrypted envelope
+func (meta *ArchiveMeta) hasEnvelope() bool {
+	return meta.Password != "" || len(meta.Recipients) > 0
+}
+
+// returns the age recipients for [ArchiveMeta.Recipients] or [ArchiveMeta.Password]
+func envelopeRecipients(meta *ArchiveMeta) ([]age.Recipient, error) {
+	// age doesn't mix a passphrase with the other recipients
+	if meta.Password != "" && len(meta.Recipients) > 0 {
+		return nil, fmt.Errorf("an archive can't be encrypted with both a password and recipients")
+	}
+
+	if meta.Password != "" {
+		recipient, err := age.NewScryptRecipient(meta.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		return []age.Recipient{recipient}, nil
+	}
+
+	var recipients []age.Recipient
+
+	for _, r := range meta.Recipients {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// returns the age identities for [ArchiveMeta.Identities] and [ArchiveMeta.Password]
+func envelopeIdentities(meta *ArchiveMeta) ([]age.Identity, error) {
+	var identities []age.Identity
+
+	for _, i := range meta.Identities {
+		identity, err := age.ParseX25519Identity(i)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if meta.Password != "" {
+		identity, err := age.NewScryptIdentity(meta.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, nil
+}
+
+// wraps [out] in an age encrypted envelope if [ArchiveMeta.Password] or [ArchiveMeta.Recipients] is set
+// closing the returned writer writes the last encrypted chunk; [out] is left open
+func newEnvelopeWriter(out io.Writer, meta *ArchiveMeta) (io.WriteCloser, error) {
+	if !meta.hasEnvelope() {
+		return nopWriteCloser{out}, nil
+	}
+
+	recipients, err := envelopeRecipients(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return age.Encrypt(out, recipients...)
+}
+
+// checks whether [source] is wrapped in an age encrypted envelope
+func isEnvelopeSource(source *archiveSource) (bool, error) {
+	header := make([]byte, len(ageEnvelopeHeader))
+	if _, err := io.ReadFull(source.reader(), header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return bytes.Equal(header, []byte(ageEnvelopeHeader)), nil
+}
+
+// the password of an envelope is checked by unwrapping its file key, the payload is not decrypted
+func (arc commonArchive) isEnvelopeEncrypted() (EncryptedArchiveInfo, error) {
+	ai := EncryptedArchiveInfo{
+		IsEncrypted:     false,
+		IsValidPassword: false,
+	}
+
+	isEnvelope, err := isEnvelopeSource(arc.source)
+	if err != nil || !isEnvelope {
+		return ai, err
+	}
+
+	ai.IsEncrypted = true
+
+	identities, err := envelopeIdentities(&arc.meta)
+	if err != nil || len(identities) < 1 {
+		return ai, err
+	}
+
+	if _, err := age.Decrypt(bufio.NewReader(arc.source.reader()), identities...); err != nil {
+		if isEnvelopeIdentityMismatch(err) {
+			return ai, nil
+		}
+
+		return ai, err
+	}
+
+	ai.IsValidPassword = true
+
+	return ai, nil
+}
+
+// decrypts the envelope of [source] as it is read, so that it can be read like a regular archive; see [archiveSource.decrypted]
+// the password is checked once, while unwrapping the file key; false is returned if the archive has no envelope
+func openArchiveEnvelope(ctx context.Context, meta *ArchiveMeta, source *archiveSource) (bool, error) {
+	isEnvelope, err := isEnvelopeSource(source)
+	if err != nil || !isEnvelope {
+		return false, err
+	}
+
+	identities, err := envelopeIdentities(meta)
+	if err != nil {
+		return true, err
+	}
+
+	if len(identities) < 1 {
+		return true, fmt.Errorf("password is required")
+	}
+
+	decrypted, err := age.Decrypt(bufio.NewReader(source.reader()), identities...)
+	if err != nil && isEnvelopeIdentityMismatch(err) {
+		return true, fmt.Errorf("invalid password")
+	}
+
+	if err != nil {
+		return true, err
+	}
+
+	// a tampered envelope fails while it is read, as every chunk is authenticated
+	source.decrypted = newContextReader(ctx, decrypted)
+
+	return true, nil
+}
+
+// checks whether the [age.Decrypt] error means that none of the identities unwraps the file key, e.g. the password is wrong;
+// the other errors, such as a malformed header, are returned as they are
+func isEnvelopeIdentityMismatch(err error) bool {
+	var noIdentityMatchErr *age.NoIdentityMatchError
+
+	return errors.As(err, &noIdentityMatchErr) || errors.Is(err, age.ErrIncorrectIdentity)
+}
@@ -0,0 +1,13 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package onearchiver
+
+import (
+	"os"
+)
+
+// the hard links are only detected on the unix systems
+func hardLinkInode(fileInfo os.FileInfo) (inodeKey, bool) {
+	return inodeKey{}, false
+}
@@ -0,0 +1,19 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package onearchiver
+
+import (
+	"os"
+	"syscall"
+)
+
+// returns the device and the inode of [fileInfo] if the file has more than one hard link
+func hardLinkInode(fileInfo os.FileInfo) (inodeKey, bool) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return inodeKey{}, false
+	}
+
+	return inodeKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,110 @@
+package onearchiver
+
+import (
+	"fmt"
+	"io"
+)
+
+// LimitExceededError is returned once an archive goes past one of its [ArchiveLimits]
+type LimitExceededError struct {
+	// name of the field of [ArchiveLimits]
+	Limit string
+
+	// the entry being read; empty if the limit is about the archive as a whole
+	Entry string
+}
+
+func (e *LimitExceededError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("archive exceeds the %s limit", e.Limit)
+	}
+
+	return fmt.Sprintf("archive exceeds the %s limit: %s", e.Limit, e.Entry)
+}
+
+// keeps count of the entries and their sizes against [ArchiveLimits]
+// the sizes in the headers and the actual bytes are counted separately, as the headers may lie
+type limitTracker struct {
+	limits      ArchiveLimits
+	archiveSize int64
+
+	entries      int
+	declaredSize int64
+	actualSize   int64
+}
+
+// [archiveSize] is the size of the archive on the disk, which the compression ratio is checked against
+// returns nil if none of [limits] is set; a nil tracker never reports a limit
+func newLimitTracker(limits ArchiveLimits, archiveSize int64) *limitTracker {
+	if limits == (ArchiveLimits{}) {
+		return nil
+	}
+
+	return &limitTracker{limits: limits, archiveSize: archiveSize}
+}
+
+// counts the entry [name] along with the size in its header
+func (lt *limitTracker) addEntry(name string, declaredSize int64) error {
+	if lt == nil {
+		return nil
+	}
+
+	lt.entries += 1
+	lt.declaredSize += declaredSize
+
+	if lt.limits.MaxEntries > 0 && lt.entries > lt.limits.MaxEntries {
+		return &LimitExceededError{Limit: "MaxEntries", Entry: name}
+	}
+
+	if lt.limits.MaxEntrySize > 0 && declaredSize > lt.limits.MaxEntrySize {
+		return &LimitExceededError{Limit: "MaxEntrySize", Entry: name}
+	}
+
+	return lt.checkTotal(name, lt.declaredSize)
+}
+
+func (lt *limitTracker) checkTotal(name string, totalSize int64) error {
+	if lt.limits.MaxTotalSize > 0 && totalSize > lt.limits.MaxTotalSize {
+		return &LimitExceededError{Limit: "MaxTotalSize", Entry: name}
+	}
+
+	if lt.limits.MaxCompressionRatio > 0 && totalSize > compressionRatioGraceSize &&
+		float64(totalSize) > float64(lt.archiveSize)*lt.limits.MaxCompressionRatio {
+		return &LimitExceededError{Limit: "MaxCompressionRatio", Entry: name}
+	}
+
+	return nil
+}
+
+// counts the bytes of the entry [name] as they are written into [w]
+func (lt *limitTracker) writer(name string, w io.Writer) io.Writer {
+	if lt == nil {
+		return w
+	}
+
+	return &limitWriter{tracker: lt, name: name, w: w}
+}
+
+type limitWriter struct {
+	tracker *limitTracker
+	name    string
+	w       io.Writer
+	written int64
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	lt := lw.tracker
+
+	lw.written += int64(len(p))
+	lt.actualSize += int64(len(p))
+
+	if lt.limits.MaxEntrySize > 0 && lw.written > lt.limits.MaxEntrySize {
+		return 0, &LimitExceededError{Limit: "MaxEntrySize", Entry: lw.name}
+	}
+
+	if err := lt.checkTotal(lw.name, lt.actualSize); err != nil {
+		return 0, err
+	}
+
+	return lw.w.Write(p)
+}
@@ -3,6 +3,7 @@ package onearchiver
 // TODO proper error handling
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"sort"
@@ -81,31 +82,51 @@ func getFilteredFiles(fileInfo ArchiveFileInfo, listDirectoryPath string, recurs
 }
 
 func GetArchiveFileList(meta *ArchiveMeta, read *ArchiveRead) ([]ArchiveFileInfo, error) {
-	_meta := *meta
+	return GetArchiveFileListContext(context.Background(), meta, read)
+}
+
+// [GetArchiveFileList] which stops once [ctx] is done and returns [ErrCancelled]
+func GetArchiveFileListContext(ctx context.Context, meta *ArchiveMeta, read *ArchiveRead) ([]ArchiveFileInfo, error) {
 	_read := *read
+	_meta := *meta
+
+	source, err := openArchiveSource(&_meta)
+	if err != nil {
+		return nil, err
+	}
+
+	defer source.close()
 
 	var arcObj ArchiveReader
 
-	// check whether the archive is encrypted
-	// if yes, check whether the password is valid
-	iae, err := IsArchiveEncrypted(meta)
+	// the envelope is decrypted as the archive is read; its password is checked while opening it
+	isEnvelope, err := openArchiveEnvelope(ctx, &_meta, source)
 	if err != nil {
 		return nil, err
 	}
 
-	/// if archive is encrypted and if password field is empty
-	/// then return 'password is required' error
-	if iae.IsEncrypted && len(_meta.Password) < 1 {
-		return nil, fmt.Errorf("password is required")
-	}
+	if !isEnvelope {
+		// check whether the archive is encrypted
+		// if yes, check whether the password is valid
+		iae, err := isArchiveEncrypted(ctx, &_meta, source, _read.Limits)
+		if err != nil {
+			return nil, err
+		}
 
-	/// if archive is encrypted and if the password is invalid
-	/// then return 'invalid password' error
-	if iae.IsEncrypted && !iae.IsValidPassword {
-		return nil, fmt.Errorf("invalid password")
+		/// if archive is encrypted and if password field is empty
+		/// then return 'password is required' error
+		if iae.IsEncrypted && len(_meta.Password) < 1 && len(_meta.Identities) < 1 {
+			return nil, fmt.Errorf("password is required")
+		}
+
+		/// if archive is encrypted and if the password is invalid
+		/// then return 'invalid password' error
+		if iae.IsEncrypted && !iae.IsValidPassword {
+			return nil, fmt.Errorf("invalid password")
+		}
 	}
 
-	ext := filepath.Ext(meta.Filename)
+	ext := filepath.Ext(_meta.Filename)
 
 	// add a trailing slash to [listDirectoryPath] if missing
 	if _read.ListDirectoryPath != "" && !strings.HasSuffix(_read.ListDirectoryPath, PathSep) {
@@ -114,10 +135,10 @@ func GetArchiveFileList(meta *ArchiveMeta, read *ArchiveRead) ([]ArchiveFileInfo
 
 	switch ext {
 	case ".zip":
-		arcObj = zipArchive{meta: _meta, read: _read}
+		arcObj = zipArchive{meta: _meta, read: _read, ctx: ctx, source: source}
 
 	default:
-		arcObj = commonArchive{meta: _meta, read: _read}
+		arcObj = commonArchive{meta: _meta, read: _read, ctx: ctx, source: source}
 	}
 
 	return arcObj.list()
@@ -31,7 +31,11 @@ func (arc commonArchive) list() ([]ArchiveFileInfo, error) {
 		return nil, err
 	}
 
-	var arcWalker, ok = arcFileObj.(archiver.Walker)
+	if isCompressedFileFormat(arcFileObj) {
+		return listCompressedFile(&arc, arcFileObj)
+	}
+
+	var arcReader, ok = arcFileObj.(archiver.Reader)
 	if !ok {
 		return nil, fmt.Errorf("some error occured while reading the archive")
 	}
@@ -45,7 +49,17 @@ func (arc commonArchive) list() ([]ArchiveFileInfo, error) {
 	ignoreList = append(ignoreList, _gitIgnorePattern...)
 	compiledGitIgnoreLines := ignore.CompileIgnoreLines(ignoreList...)
 
-	err = arcWalker.Walk(_filename, func(file archiver.File) error {
+	limits := newLimitTracker(arc.read.Limits, arc.source.size)
+
+	err = walkArchive(arcReader, arc.source.reader(), func(file archiver.File) error {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
+		if err := limits.addEntry(file.Name(), file.Size()); err != nil {
+			return err
+		}
+
 		var fileInfo ArchiveFileInfo
 
 		switch fileHeader := file.Header.(type) {
@@ -119,6 +133,10 @@ func (arc commonArchive) list() ([]ArchiveFileInfo, error) {
 		return nil
 	})
 
+	if err != nil {
+		return nil, err
+	}
+
 	if !isListDirectoryPathExist {
 		return filteredPaths, fmt.Errorf("path not found to filter: %s", _listDirectoryPath)
 	}
@@ -12,7 +12,6 @@ import (
 // list files in zip archives
 // yeka package is used here to list encrypted zip files
 func (arc zipArchive) list() ([]ArchiveFileInfo, error) {
-	_filename := arc.meta.Filename
 	_listDirectoryPath := arc.read.ListDirectoryPath
 	_password := arc.meta.Password
 	_recursive := arc.read.Recursive
@@ -20,17 +19,11 @@ func (arc zipArchive) list() ([]ArchiveFileInfo, error) {
 	_orderDir := arc.read.OrderDir
 	_gitIgnorePattern := arc.meta.GitIgnorePattern
 
-	reader, err := zip.OpenReader(_filename)
+	reader, err := zip.NewReader(arc.source, arc.source.size)
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if err = reader.Close(); err != nil {
-			fmt.Printf("%v\n", err)
-		}
-	}()
-
 	var filteredPaths []ArchiveFileInfo
 
 	isListDirectoryPathExist := _listDirectoryPath == ""
@@ -40,11 +33,21 @@ func (arc zipArchive) list() ([]ArchiveFileInfo, error) {
 	ignoreList = append(ignoreList, _gitIgnorePattern...)
 	compiledGitIgnoreLines := ignore.CompileIgnoreLines(ignoreList...)
 
+	limits := newLimitTracker(arc.read.Limits, arc.source.size)
+
 	for _, file := range reader.File {
+		if err := checkContext(arc.ctx); err != nil {
+			return nil, err
+		}
+
 		if _password != "" {
 			file.SetPassword(_password)
 		}
 
+		if err := limits.addEntry(file.Name, int64(file.UncompressedSize64)); err != nil {
+			return nil, err
+		}
+
 		fullPath := filepath.ToSlash(file.Name)
 		isDir := file.FileInfo().IsDir()
 		name := file.FileInfo().Name()
@@ -58,6 +61,7 @@ func (arc zipArchive) list() ([]ArchiveFileInfo, error) {
 			FullPath:   fullPath,
 			ParentPath: GetParentDirectory(fullPath),
 			Extension:  extension(name),
+			Comment:    file.Comment,
 		}
 
 		fileInfo.FullPath = fixDirSlash(fileInfo.IsDir, fileInfo.FullPath)
@@ -0,0 +1,142 @@
+//go:build linux
+// +build linux
+
+package onearchiver
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// [syscall] doesn't export these on linux
+const (
+	atFdCwd           = -0x64
+	atSymlinkNoFollow = 0x100
+)
+
+// returns the extended attributes of [filename]; the posix acls are stored as the system.posix_acl_* attributes
+// the filesystems without xattr support yield no attributes
+func readXattrs(filename string) (map[string]string, error) {
+	xattrs := make(map[string]string)
+
+	size, err := syscall.Listxattr(filename, nil)
+	if err != nil {
+		if isXattrUnsupported(err) {
+			return xattrs, nil
+		}
+
+		return nil, err
+	}
+
+	if size < 1 {
+		return xattrs, nil
+	}
+
+	names := make([]byte, size)
+
+	size, err = syscall.Listxattr(filename, names)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) < 1 {
+			continue
+		}
+
+		valueSize, err := syscall.Getxattr(filename, string(name), nil)
+		if err != nil {
+			// the attribute might have been removed in the meantime
+			continue
+		}
+
+		value := make([]byte, valueSize)
+
+		valueSize, err = syscall.Getxattr(filename, string(name), value)
+		if err != nil {
+			continue
+		}
+
+		xattrs[string(name)] = string(value[:valueSize])
+	}
+
+	return xattrs, nil
+}
+
+// sets the extended attribute [name] of [filename] without following the symlinks
+// the missing permissions (e.g. trusted.* as a regular user) and the filesystems without xattr support are not treated as errors
+func writeXattr(filename string, name string, value string) error {
+	err := lsetxattr(filename, name, []byte(value))
+	if err != nil && (isXattrUnsupported(err) || err == syscall.EPERM || err == syscall.EACCES) {
+		return nil
+	}
+
+	return err
+}
+
+// [syscall] doesn't provide lsetxattr
+func lsetxattr(filename string, name string, value []byte) error {
+	path, err := syscall.BytePtrFromString(filename)
+	if err != nil {
+		return err
+	}
+
+	attr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	var data unsafe.Pointer
+	if len(value) > 0 {
+		data = unsafe.Pointer(&value[0])
+	}
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_LSETXATTR, uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(attr)), uintptr(data), uintptr(len(value)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func isXattrUnsupported(err error) bool {
+	return err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP
+}
+
+// changes the owner of [filename] without following the symlinks
+// only a privileged user can give the files away, the files are left owned by the current user otherwise
+func lchownFile(filename string, uid int, gid int) error {
+	err := os.Lchown(filename, uid, gid)
+	if err != nil && os.IsPermission(err) {
+		return nil
+	}
+
+	return err
+}
+
+// changes the access and the mod times of [filename] without following the symlinks
+func lchtimesFile(filename string, accessTime time.Time, modTime time.Time) error {
+	path, err := syscall.BytePtrFromString(filename)
+	if err != nil {
+		return err
+	}
+
+	times := [2]syscall.Timespec{
+		syscall.NsecToTimespec(accessTime.UnixNano()),
+		syscall.NsecToTimespec(modTime.UnixNano()),
+	}
+
+	// the relative paths are resolved from the working directory
+	dirFd := atFdCwd
+
+	// [syscall] doesn't provide utimensat with AT_SYMLINK_NOFOLLOW
+	_, _, errno := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(dirFd), uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&times)), atSymlinkNoFollow, 0, 0)
+	if errno != 0 {
+		return &os.PathError{Op: "chtimes", Path: filename, Err: errno}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+package onearchiver
+
+import (
+	"os"
+	"time"
+)
+
+// the extended attributes and the ownership are only restored on linux
+func readXattrs(filename string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func writeXattr(filename string, name string, value string) error {
+	return nil
+}
+
+func lchownFile(filename string, uid int, gid int) error {
+	return nil
+}
+
+// the times of the symlinks are left alone, as [os.Chtimes] would set them on the link targets
+func lchtimesFile(filename string, accessTime time.Time, modTime time.Time) error {
+	fileInfo, err := os.Lstat(filename)
+	if err != nil {
+		return err
+	}
+
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	return os.Chtimes(filename, accessTime, modTime)
+}
@@ -1,24 +1,27 @@
 package onearchiver
 
 import (
+	"context"
 	"fmt"
 	"github.com/ganeshrvel/archiver"
 	ignore "github.com/sabhiram/go-gitignore"
 	"github.com/wesovilabs/koazee"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func (arc zipArchive) doPack(ph *ProgressHandler) error {
 	_fileList := arc.pack.FileList
 
-	commonParentPath := GetCommonParentPath(os.PathSeparator, _fileList...)
+	commonParentPath := packingCommonParentPath(_fileList)
 
-	if indexExists(&_fileList, 0) && commonParentPath == _fileList[0] {
-		commonParentPathSplitted := strings.Split(_fileList[0], PathSep)
-
-		commonParentPath = strings.Join(commonParentPathSplitted[:len(commonParentPathSplitted)-1], PathSep)
+	if arc.pack.UpdateExisting && FileExists(arc.meta.Filename) {
+		return updateZipFile(&arc, _fileList, commonParentPath, ph)
 	}
 
 	if err := createZipFile(&arc, _fileList, commonParentPath, ph); err != nil {
@@ -38,54 +41,26 @@ func (arc commonArchive) doPack(ph *ProgressHandler) error {
 		return err
 	}
 
-	err = archiveFormat(&arcFileObj, "", OverwriteExisting)
-
-	if err != nil {
-		return err
-	}
-
-	commonParentPath := GetCommonParentPath(os.PathSeparator, _fileList...)
-
-	if indexExists(&_fileList, 0) && commonParentPath == _fileList[0] {
-		commonParentPathSplitted := strings.Split(_fileList[0], PathSep)
+	commonParentPath := packingCommonParentPath(_fileList)
+
+	// the tarballs are written using [archive/tar] on top of [newCompressor]
+	// so that the [CompressionOptions] reach the compressed stream
+	switch arcFileObj.(type) {
+	case *archiver.Tar, *archiver.TarGz, *archiver.TarBz2, *archiver.TarBrotli,
+		*archiver.TarLz4, *archiver.TarSz, *archiver.TarXz, *archiver.TarZstd:
+		if arc.pack.UpdateExisting && FileExists(_filename) {
+			// the entries of an envelope can't be appended to or copied over without decrypting the whole tarball
+			if arc.meta.hasEnvelope() {
+				return fmt.Errorf("updating an encrypted tarball is not supported")
+			}
 
-		commonParentPath = strings.Join(commonParentPathSplitted[:len(commonParentPathSplitted)-1], PathSep)
-	}
+			err = updateTarball(&arc, arcFileObj, &_fileList, commonParentPath, ph)
+		} else {
+			err = packTarballs(&arc, arcFileObj, &_fileList, commonParentPath, ph)
+		}
 
-	switch archValue := arcFileObj.(type) {
-	case *archiver.Tar:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-	case *archiver.TarGz:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-	case *archiver.TarBz2:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-	case *archiver.TarBrotli:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-	case *archiver.TarLz4:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-	case *archiver.TarSz:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-	case *archiver.TarXz:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-	case *archiver.TarZstd:
-		err = packTarballs(&arc, archValue, &_fileList, commonParentPath, ph)
-
-	// Todo: parking the development of file compressors for now.
-	// It requires a different logic for listing, compressing and uncompressing
-	//case *archiver.Gz:
-	//	err = packCompressFile(&arc, archValue, &_fileList)
-	//case *archiver.Brotli:
-	//	err = packCompressFile(&arc, archValue, &_fileList)
-	//case *archiver.Bz2:
-	//	err = packCompressFile(&arc, archValue, &_fileList)
-	//case *archiver.Lz4:
-	//	err = packCompressFile(&arc, archValue, &_fileList)
-	//case *archiver.Snappy:
-	//	err = packCompressFile(&arc, archValue, &_fileList)
-	//case *archiver.Xz:
-	//	err = packCompressFile(&arc, archValue, &_fileList)
-	//case *archiver.Zstd:
-	//	err = packCompressFile(&arc, archValue, &_fileList)
+	case *archiver.Gz, *archiver.Bz2, *archiver.Brotli, *archiver.Lz4, *archiver.Snappy, *archiver.Xz, *archiver.Zstd:
+		err = packCompressedFile(&arc, arcFileObj, &_fileList, commonParentPath, ph)
 
 	default:
 		return fmt.Errorf("archive file format is not supported")
@@ -99,6 +74,12 @@ func (arc commonArchive) doPack(ph *ProgressHandler) error {
 }
 
 func StartPacking(meta *ArchiveMeta, pack *ArchivePack, ph *ProgressHandler) error {
+	return StartPackingContext(context.Background(), meta, pack, ph)
+}
+
+// [StartPacking] which stops once [ctx] is done and returns [ErrCancelled]
+// the partially written archive is removed, and an existing archive is left as it was
+func StartPackingContext(ctx context.Context, meta *ArchiveMeta, pack *ArchivePack, ph *ProgressHandler) error {
 	_meta := *meta
 	_pack := *pack
 
@@ -106,27 +87,176 @@ func StartPacking(meta *ArchiveMeta, pack *ArchivePack, ph *ProgressHandler) err
 
 	ext := filepath.Ext(_meta.Filename)
 
-	if OverwriteExisting && FileExists(_meta.Filename) {
-		if err := os.Remove(_meta.Filename); err != nil {
-			return err
-		}
+	if _pack.UpdateExisting && _pack.VolumeSize > 0 {
+		return fmt.Errorf("updating a split archive is not supported")
+	}
+
+	if ext == ".zip" && len(_meta.Recipients) > 0 {
+		return fmt.Errorf("zip files can only be encrypted with a password")
+	}
+
+	if err := checkContext(ctx); err != nil {
+		return err
 	}
 
 	switch ext {
 	case ".zip":
-		arcPackObj = zipArchive{meta: _meta, pack: _pack}
+		arcPackObj = zipArchive{meta: _meta, pack: _pack, ctx: ctx}
 
 		break
 
 	default:
-		arcPackObj = commonArchive{meta: _meta, pack: _pack}
+		arcPackObj = commonArchive{meta: _meta, pack: _pack, ctx: ctx}
 
 		break
 	}
 
+	// the new archive is written into a temp file and moved in place once it is complete, along with removing
+	// the copies of an earlier packing which don't match it; hence the existing archive is left as it is on any error
 	return arcPackObj.doPack(ph)
 }
 
+// writes the archive of [format] into [out] instead of [ArchiveMeta.Filename], which is ignored here
+// [out] is left open; it doesn't have to be seekable, zip entries are written with data descriptors
+// [ArchivePack.UpdateExisting] is not supported as there is no existing archive to read from
+func StartPackingToWriter(out io.Writer, format ArchiveFormat, meta *ArchiveMeta, pack *ArchivePack, ph *ProgressHandler) error {
+	return StartPackingToWriterContext(context.Background(), out, format, meta, pack, ph)
+}
+
+// [StartPackingToWriter] which stops once [ctx] is done and returns [ErrCancelled]; whatever was written into [out] is left to the caller
+func StartPackingToWriterContext(ctx context.Context, out io.Writer, format ArchiveFormat, meta *ArchiveMeta, pack *ArchivePack, ph *ProgressHandler) error {
+	_meta := *meta
+	_pack := *pack
+	_fileList := _pack.FileList
+
+	if _pack.UpdateExisting {
+		return fmt.Errorf("updating an archive is not supported while packing to a writer")
+	}
+
+	if _pack.VolumeSize > 0 {
+		return fmt.Errorf("splitting an archive into volumes is not supported while packing to a writer")
+	}
+
+	commonParentPath := packingCommonParentPath(_fileList)
+
+	if format == FormatZip {
+		if len(_meta.Recipients) > 0 {
+			return fmt.Errorf("zip files can only be encrypted with a password")
+		}
+
+		arc := zipArchive{meta: _meta, pack: _pack, ctx: ctx}
+
+		return writeZipFile(&arc, out, _fileList, commonParentPath, ph)
+	}
+
+	arcFileObj, err := format.tarballFormat()
+	if err != nil {
+		return err
+	}
+
+	arc := commonArchive{meta: _meta, pack: _pack, ctx: ctx}
+
+	return writeTarballEnvelope(&arc, arcFileObj, out, &_fileList, commonParentPath, ph)
+}
+
+// returns the path which the archive paths of [fileList] are relative to
+func packingCommonParentPath(fileList []string) string {
+	commonParentPath := GetCommonParentPath(os.PathSeparator, fileList...)
+
+	if indexExists(&fileList, 0) && commonParentPath == fileList[0] {
+		commonParentPathSplitted := strings.Split(fileList[0], PathSep)
+
+		commonParentPath = strings.Join(commonParentPathSplitted[:len(commonParentPathSplitted)-1], PathSep)
+	}
+
+	return commonParentPath
+}
+
+// returns the files to pack sorted by their path inside the archive, so that the entry order doesn't change between the runs
+func sortedPackingFileList(zipFilePathListMap map[string]createArchiveFileInfo) []createArchiveFileInfo {
+	fileList := make([]createArchiveFileInfo, 0, len(zipFilePathListMap))
+
+	for _, item := range zipFilePathListMap {
+		fileList = append(fileList, item)
+	}
+
+	sort.SliceStable(fileList, func(i, j int) bool {
+		return fileList[i].relativeFilePath < fileList[j].relativeFilePath
+	})
+
+	return fileList
+}
+
+// key of the files in the [ArchivePack.UpdateExisting] mode; the archived paths may or may not carry a trailing slash for the directories
+func archivePathKey(relativeFilePath string) string {
+	return strings.TrimSuffix(filepath.ToSlash(relativeFilePath), "/")
+}
+
+// returns the files to pack keyed by [archivePathKey]
+func packingFileListByArchivePath(zipFilePathListMap map[string]createArchiveFileInfo) map[string]createArchiveFileInfo {
+	result := make(map[string]createArchiveFileInfo, len(zipFilePathListMap))
+
+	for _, item := range zipFilePathListMap {
+		result[archivePathKey(item.relativeFilePath)] = item
+	}
+
+	return result
+}
+
+// checks whether the file on the disk differs from its archived copy
+// [modTimePrecision] is the resolution of the mod times stored in the archive format
+func isPackingFileChanged(item *createArchiveFileInfo, archivedSize int64, archivedModTime time.Time, modTimePrecision time.Duration) bool {
+	if item.isDir {
+		return false
+	}
+
+	size := (*item.fileInfo).Size()
+	if item.linkTarget != "" {
+		size = int64(len(filepath.ToSlash(item.linkTarget)))
+	}
+
+	if size != archivedSize {
+		return true
+	}
+
+	diff := (*item.fileInfo).ModTime().Sub(archivedModTime)
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff >= modTimePrecision
+}
+
+// mod time of the entries in the [ArchivePack.Reproducible] mode
+func (pack *ArchivePack) sourceDateEpoch() time.Time {
+	if !pack.SourceDateEpoch.IsZero() {
+		return pack.SourceDateEpoch.UTC()
+	}
+
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+
+	return time.Unix(0, 0).UTC()
+}
+
+// permissions of the entries in the [ArchivePack.Reproducible] mode
+func reproducibleFileMode(mode os.FileMode) os.FileMode {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return os.ModeSymlink | 0777
+
+	case mode.IsDir():
+		return os.ModeDir | 0755
+
+	case mode&0111 != 0:
+		return 0755
+
+	default:
+		return 0644
+	}
+}
+
 func getArchiveFilesRelativePath(absFilepath string, commonParentPath string) string {
 	splittedFilepath := strings.Split(absFilepath, commonParentPath)
 
@@ -136,7 +266,39 @@ func getArchiveFilesRelativePath(absFilepath string, commonParentPath string) st
 	return lastItem.String()
 }
 
-func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo, fileList *[]string, commonParentPath string, gitIgnorePattern *[]string) error {
+// collects the files to pack from [ArchivePack.FileList], [ArchivePack.PathMappings] and [ArchivePack.VirtualFiles]
+// and applies [ArchivePack.ArchivePrefix]; see [processVirtualFilesForPacking] for [requireSize]
+// the files which are left out are recorded into [skipLog], which can be nil
+func collectFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo, meta *ArchiveMeta, pack *ArchivePack, fileList *[]string, commonParentPath string, requireSize bool, skipLog *packingSkipLog) error {
+	_gitIgnorePattern := meta.GitIgnorePattern
+
+	err := processFilesForPacking(zipFilePathListMap, fileList, commonParentPath, &_gitIgnorePattern, pack.IgnoreFileNames, pack.SymlinkPolicy, skipLog)
+	if err != nil {
+		return err
+	}
+
+	err = processPathMappingsForPacking(zipFilePathListMap, pack.PathMappings, &_gitIgnorePattern, pack.IgnoreFileNames, pack.SymlinkPolicy, skipLog)
+	if err != nil {
+		return err
+	}
+
+	err = processVirtualFilesForPacking(zipFilePathListMap, pack.VirtualFiles, requireSize)
+	if err != nil {
+		return err
+	}
+
+	err = applyArchivePrefix(zipFilePathListMap, pack.ArchivePrefix)
+	if err != nil {
+		return err
+	}
+
+	// the filters see the final paths inside the archive
+	applyPackingFilters(zipFilePathListMap, pack, skipLog)
+
+	return nil
+}
+
+func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo, fileList *[]string, commonParentPath string, gitIgnorePattern *[]string, ignoreFileNames []string, symlinkPolicy SymlinkPolicy, skipLog *packingSkipLog) error {
 	_zipFilePathListMap := *zipFilePathListMap
 	_fileList := *fileList
 
@@ -146,14 +308,51 @@ func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo
 
 	ignoreMatches := ignore.CompileIgnoreLines(ignoreList...)
 
+	// real paths of the symlinked directories which are currently being walked; guards against symlink loops
+	followedDirs := make(map[string]bool)
+
 	for _, item := range _fileList {
-		err := filepath.Walk(item, func(absFilepath string, fileInfo os.FileInfo, err error) error {
+		var walkFn filepath.WalkFunc
+
+		// the ignore files are scoped to the directory tree of [item]
+		ignoreFiles := newIgnoreFileMatcher(ignoreFileNames)
+
+		walkFn = func(absFilepath string, fileInfo os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 
+			linkTarget := ""
+
 			if isSymlink(fileInfo) {
-				return nil
+				switch symlinkPolicy {
+				case SymlinkPolicyStore:
+					linkTarget, err = os.Readlink(absFilepath)
+					if err != nil {
+						return err
+					}
+
+				case SymlinkPolicyFollow:
+					targetFileInfo, err := os.Stat(absFilepath)
+
+					// skip the dangling symlinks
+					if err != nil {
+						skipLog.record(absFilepath, "dangling symlink")
+
+						return nil
+					}
+
+					if targetFileInfo.IsDir() {
+						return followSymlinkedDir(absFilepath, followedDirs, walkFn)
+					}
+
+					fileInfo = targetFileInfo
+
+				default:
+					skipLog.record(absFilepath, "symlink")
+
+					return nil
+				}
 			}
 
 			absFilepath = filepath.ToSlash(absFilepath)
@@ -189,10 +388,29 @@ func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo
 			relativeFilePath = strings.TrimLeft(relativeFilePath, PathSep)
 
 			// ignore the files if pattern matches
-			if ignoreMatches.MatchesPath(relativeFilePath) {
+			if matched, ignorePattern := ignoreMatches.MatchesPathHow(relativeFilePath); matched {
+				skipLog.record(absFilepath, fmt.Sprintf("ignore pattern %q", ignorePattern.Line))
+
 				return nil
 			}
 
+			// like git, the files inside an ignored directory can't be included back
+			if matched, ignoreRule := ignoreFiles.matches(absFilepath, isFileADir); matched {
+				skipLog.record(absFilepath, ignoreRule)
+
+				if isFileADir {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if isFileADir {
+				if err := ignoreFiles.loadDir(absFilepath); err != nil {
+					return err
+				}
+			}
+
 			// when the commonpath is used to construct the relative path, the parent directories in the filepath list doesnt get written into the archive file
 			if commonParentPath != "" && absFilepath != commonParentPath {
 				if item == absFilepath {
@@ -206,10 +424,19 @@ func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo
 						}
 
 						_absFilepath := filepath.Join(commonParentPath, _relativeFilePath)
-
-						_fileInfo, err := os.Lstat(_absFilepath)
-						if err != nil {
-							return err
+						_linkTarget := ""
+
+						var _fileInfo os.FileInfo
+
+						// the selected path itself might be a symlink, which was resolved above
+						if _absFilepath == filepath.Clean(filepath.FromSlash(absFilepath)) {
+							_fileInfo = fileInfo
+							_linkTarget = linkTarget
+						} else {
+							_fileInfo, err = os.Lstat(_absFilepath)
+							if err != nil {
+								return err
+							}
 						}
 
 						isDir := _fileInfo.IsDir()
@@ -222,6 +449,7 @@ func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo
 							relativeFilePath: _relativeFilePath,
 							isDir:            isDir,
 							fileInfo:         &_fileInfo,
+							linkTarget:       _linkTarget,
 						}
 					}
 
@@ -236,10 +464,13 @@ func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo
 				relativeFilePath: relativeFilePath,
 				isDir:            isFileADir,
 				fileInfo:         &fileInfo,
+				linkTarget:       linkTarget,
 			}
 
 			return nil
-		})
+		}
+
+		err := filepath.Walk(item, walkFn)
 
 		if err != nil {
 			return err
@@ -248,3 +479,28 @@ func processFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo
 
 	return nil
 }
+
+// walks the directory which the symlink [absFilepath] points to as if it was a regular directory
+func followSymlinkedDir(absFilepath string, followedDirs map[string]bool, walkFn filepath.WalkFunc) error {
+	realTargetPath, err := filepath.EvalSymlinks(absFilepath)
+	if err != nil {
+		return nil
+	}
+
+	realParentPath, err := filepath.EvalSymlinks(filepath.Dir(absFilepath))
+	if err != nil {
+		return err
+	}
+
+	// skip the symlinks pointing to a directory which is already being walked
+	if followedDirs[realTargetPath] || subpathExists(fixDirSlash(true, realTargetPath), fixDirSlash(true, realParentPath)) {
+		return nil
+	}
+
+	followedDirs[realTargetPath] = true
+
+	defer delete(followedDirs, realTargetPath)
+
+	// the trailing slash makes [filepath.Walk] resolve the symlink instead of stopping at it
+	return filepath.Walk(fixDirSlash(true, absFilepath), walkFn)
+}
@@ -0,0 +1,82 @@
+package onearchiver
+
+import (
+	"path/filepath"
+)
+
+// drops the files which don't pass the filters of [pack]; the in-memory files are always kept
+func applyPackingFilters(zipFilePathListMap *map[string]createArchiveFileInfo, pack *ArchivePack, skipLog *packingSkipLog) {
+	_zipFilePathListMap := *zipFilePathListMap
+
+	for key, item := range _zipFilePathListMap {
+		if item.virtualFile != nil {
+			continue
+		}
+
+		if reason := pack.excludedBy(&item); reason != "" {
+			skipLog.record(item.absFilepath, reason)
+
+			delete(_zipFilePathListMap, key)
+		}
+	}
+}
+
+// returns the filter which leaves [item] out; empty if [item] is packed
+func (pack *ArchivePack) excludedBy(item *createArchiveFileInfo) string {
+	fileInfo := *item.fileInfo
+
+	if len(pack.FileTypes) > 0 && !containsFileType(pack.FileTypes, packingFileType(item)) {
+		return "file type filter"
+	}
+
+	if !item.isDir {
+		if pack.MinSize > 0 && fileInfo.Size() < pack.MinSize {
+			return "min size filter"
+		}
+
+		if pack.MaxSize > 0 && fileInfo.Size() > pack.MaxSize {
+			return "max size filter"
+		}
+
+		if !pack.ModifiedAfter.IsZero() && fileInfo.ModTime().Before(pack.ModifiedAfter) {
+			return "modified after filter"
+		}
+
+		if !pack.ModifiedBefore.IsZero() && !fileInfo.ModTime().Before(pack.ModifiedBefore) {
+			return "modified before filter"
+		}
+	}
+
+	if pack.FilterFunc != nil && !pack.FilterFunc(filepath.ToSlash(item.relativeFilePath), fileInfo) {
+		return "filter func"
+	}
+
+	return ""
+}
+
+// the followed symlinks carry the file info of their targets, hence they take the type of the target
+func packingFileType(item *createArchiveFileInfo) FileType {
+	switch {
+	case item.isDir:
+		return FileTypeDir
+
+	case item.linkTarget != "":
+		return FileTypeSymlink
+
+	case (*item.fileInfo).Mode().IsRegular():
+		return FileTypeRegular
+
+	default:
+		return FileTypeOther
+	}
+}
+
+func containsFileType(fileTypes []FileType, fileType FileType) bool {
+	for _, t := range fileTypes {
+		if t == fileType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package onearchiver
+
+import (
+	"archive/tar"
+	"path/filepath"
+)
+
+type inodeKey struct {
+	dev, ino uint64
+}
+
+// remembers the first archived path of every inode, so that the later paths of the same inode are written as hard links
+type hardLinkTracker struct {
+	archivedPaths map[inodeKey]string
+}
+
+// returns nil if [ArchivePack.DetectHardLinks] is disabled; a nil tracker never reports a hard link
+func newHardLinkTracker(pack *ArchivePack) *hardLinkTracker {
+	if !pack.DetectHardLinks {
+		return nil
+	}
+
+	return &hardLinkTracker{archivedPaths: make(map[inodeKey]string)}
+}
+
+// returns the archived path which [item] is a hard link to; otherwise [item] is remembered as the first path of its inode
+func (hl *hardLinkTracker) linkName(item *createArchiveFileInfo) (string, bool) {
+	if hl == nil || item.virtualFile != nil || item.isDir || item.linkTarget != "" || !(*item.fileInfo).Mode().IsRegular() {
+		return "", false
+	}
+
+	key, ok := hardLinkInode(*item.fileInfo)
+	if !ok {
+		return "", false
+	}
+
+	if linkName, ok := hl.archivedPaths[key]; ok {
+		return linkName, true
+	}
+
+	hl.archivedPaths[key] = filepath.ToSlash(item.relativeFilePath)
+
+	return "", false
+}
+
+// turns [header] into a hard link to [linkName]; a hard link has no contents of its own
+func setTarHardLink(header *tar.Header, linkName string) {
+	header.Typeflag = tar.TypeLink
+	header.Linkname = linkName
+	header.Size = 0
+}
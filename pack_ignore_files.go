@@ -0,0 +1,145 @@
+package onearchiver
+
+import (
+	"fmt"
+	ignore "github.com/sabhiram/go-gitignore"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// applies the ignore files (.gitignore..) found while walking; the patterns of a file are scoped to its directory
+// and the deeper files take precedence over the outer ones, like git does
+type ignoreFileMatcher struct {
+	fileNames []string
+
+	// keyed by the slashed directory path with a trailing slash
+	layers map[string]*ignoreLayer
+}
+
+// the patterns of a directory compiled twice, as the negations only take effect on a path which is ignored already
+type ignoreLayer struct {
+	// for the paths which the outer directories don't ignore
+	patterns *ignore.GitIgnore
+
+	// for the paths which the outer directories ignore; a leading match-all pattern carries over the ignored state
+	ignoredPatterns *ignore.GitIgnore
+
+	// ignore file and the line number of each of the patterns, in the "file:line:pattern" form of git check-ignore
+	rules []string
+}
+
+// returns nil if [fileNames] is empty; a nil matcher never ignores a path
+func newIgnoreFileMatcher(fileNames []string) *ignoreFileMatcher {
+	if len(fileNames) < 1 {
+		return nil
+	}
+
+	return &ignoreFileMatcher{
+		fileNames: fileNames,
+		layers:    make(map[string]*ignoreLayer),
+	}
+}
+
+// reads the ignore files of the directory [dirPath]; it has to be called before the contents of the directory are walked
+func (m *ignoreFileMatcher) loadDir(dirPath string) error {
+	if m == nil {
+		return nil
+	}
+
+	var lines []string
+	var rules []string
+
+	for _, fileName := range m.fileNames {
+		ignoreFilename := filepath.Join(dirPath, fileName)
+
+		contents, err := ioutil.ReadFile(ignoreFilename)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for index, line := range strings.Split(string(contents), "\n") {
+			lines = append(lines, line)
+			rules = append(rules, fmt.Sprintf("%s:%d:%s", ignoreFilename, index+1, strings.TrimRight(line, "\r")))
+		}
+	}
+
+	if len(lines) < 1 {
+		return nil
+	}
+
+	m.layers[ignoreLayerKey(dirPath)] = &ignoreLayer{
+		patterns:        ignore.CompileIgnoreLines(lines...),
+		ignoredPatterns: ignore.CompileIgnoreLines(append([]string{"*"}, lines...)...),
+		rules:           rules,
+	}
+
+	return nil
+}
+
+// checks whether the ignore files of the parent directories of [absFilepath] ignore it; the rule which ignores it is returned as well
+func (m *ignoreFileMatcher) matches(absFilepath string, isDir bool) (bool, string) {
+	if m == nil || len(m.layers) < 1 {
+		return false, ""
+	}
+
+	slashedPath := strings.TrimSuffix(filepath.ToSlash(absFilepath), "/")
+
+	// the parent directories from the outermost one
+	var parentDirs []string
+	for dir := path.Dir(slashedPath); ; dir = path.Dir(dir) {
+		parentDirs = append([]string{dir}, parentDirs...)
+
+		if dir == path.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	rule := ""
+
+	for _, dir := range parentDirs {
+		key := ignoreLayerKey(dir)
+
+		layer, ok := m.layers[key]
+		if !ok {
+			continue
+		}
+
+		relativePath := strings.TrimPrefix(slashedPath, key)
+		if isDir {
+			relativePath += "/"
+		}
+
+		if ignored {
+			matched, pattern := layer.ignoredPatterns.MatchesPathHow(relativePath)
+
+			// the leading match-all pattern keeps the rule of the outer directory
+			if matched && pattern.LineNo > 1 {
+				rule = layer.rules[pattern.LineNo-2]
+			}
+
+			ignored = matched
+		} else {
+			matched, pattern := layer.patterns.MatchesPathHow(relativePath)
+
+			if matched {
+				rule = layer.rules[pattern.LineNo-1]
+			}
+
+			ignored = matched
+		}
+	}
+
+	return ignored, rule
+}
+
+func ignoreLayerKey(dirPath string) string {
+	return strings.TrimSuffix(filepath.ToSlash(dirPath), "/") + "/"
+}
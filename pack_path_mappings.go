@@ -0,0 +1,176 @@
+package onearchiver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cleans up a path inside the archive into a relative slash separated path; a trailing slash marks a directory
+// an empty path is returned if [name] points to the root of the archive or outside of it
+func cleanArchivePath(name string) (string, bool) {
+	name = strings.TrimLeft(filepath.ToSlash(name), "/")
+	cleanedName := path.Clean(name)
+
+	if name == "" || cleanedName == "." || cleanedName == ".." || strings.HasPrefix(cleanedName, "../") {
+		return "", false
+	}
+
+	isDir := strings.HasSuffix(name, "/")
+
+	return fixDirSlash(isDir, cleanedName), isDir
+}
+
+// adds the files of [pathMappings] under their archive paths
+// the common parent path heuristics of [ArchivePack.FileList] don't apply here
+// a file which ends up at the same archive path as a file of [ArchivePack.FileList] or of another mapping is refused;
+// the directories which end up at the same path are merged
+func processPathMappingsForPacking(zipFilePathListMap *map[string]createArchiveFileInfo, pathMappings []PathMapping, gitIgnorePattern *[]string, ignoreFileNames []string, symlinkPolicy SymlinkPolicy, skipLog *packingSkipLog) error {
+	_zipFilePathListMap := *zipFilePathListMap
+
+	if len(pathMappings) < 1 {
+		return nil
+	}
+
+	// keys of [_zipFilePathListMap] by their archive paths
+	archivePathKeys := make(map[string]string, len(_zipFilePathListMap))
+	for key, item := range _zipFilePathListMap {
+		archivePathKeys[archivePathKey(item.relativeFilePath)] = key
+	}
+
+	for _, pathMapping := range pathMappings {
+		source := filepath.Clean(pathMapping.Source)
+
+		archivePath := ""
+		if cleanedArchivePath := path.Clean(filepath.ToSlash(pathMapping.ArchivePath)); cleanedArchivePath != "." && cleanedArchivePath != "/" {
+			archivePath, _ = cleanArchivePath(cleanedArchivePath)
+
+			if archivePath == "" {
+				return fmt.Errorf("invalid archive path: %s", pathMapping.ArchivePath)
+			}
+		}
+
+		if !isDirectory(source) && archivePath == "" {
+			return fmt.Errorf("a file can't be mapped to the root of the archive: %s", pathMapping.Source)
+		}
+
+		// the source is packed on its own first; its entries then start with the name of the source
+		sourceFileList := []string{source}
+		sourceFilePathListMap := make(map[string]createArchiveFileInfo)
+
+		err := processFilesForPacking(&sourceFilePathListMap, &sourceFileList, packingCommonParentPath(sourceFileList), gitIgnorePattern, ignoreFileNames, symlinkPolicy, skipLog)
+		if err != nil {
+			return err
+		}
+
+		sourceName := filepath.Base(source)
+
+		for _, item := range sourceFilePathListMap {
+			_item := item
+
+			relativeFilePath := strings.TrimPrefix(filepath.ToSlash(_item.relativeFilePath), sourceName)
+			relativeFilePath = strings.TrimLeft(path.Join(archivePath, relativeFilePath), "/")
+
+			// the source directory itself is the root of the archive
+			if relativeFilePath == "" {
+				continue
+			}
+
+			_item.relativeFilePath = filepath.FromSlash(fixDirSlash(_item.isDir, relativeFilePath))
+
+			if key, ok := archivePathKeys[archivePathKey(_item.relativeFilePath)]; ok {
+				if !_item.isDir || !_zipFilePathListMap[key].isDir {
+					return fmt.Errorf("more than one file is packed at the archive path: %s", filepath.ToSlash(_item.relativeFilePath))
+				}
+
+				// the parent directories added for the previous mappings give way to the directory on the disk
+				if !strings.HasPrefix(key, virtualFileKeyPrefix) {
+					continue
+				}
+
+				delete(_zipFilePathListMap, key)
+			}
+
+			key := fmt.Sprintf("%s%s", pathMappingKeyPrefix, _item.relativeFilePath)
+
+			_zipFilePathListMap[key] = _item
+			archivePathKeys[archivePathKey(_item.relativeFilePath)] = key
+		}
+
+		if parentPath := path.Dir(strings.TrimSuffix(archivePath, "/")); parentPath != "." {
+			addArchiveParentDirs(&_zipFilePathListMap, parentPath)
+
+			for key, item := range _zipFilePathListMap {
+				archivePathKeys[archivePathKey(item.relativeFilePath)] = key
+			}
+		}
+	}
+
+	return nil
+}
+
+// prepends [prefix] to the path of every file to pack
+func applyArchivePrefix(zipFilePathListMap *map[string]createArchiveFileInfo, prefix string) error {
+	_zipFilePathListMap := *zipFilePathListMap
+
+	if prefix == "" {
+		return nil
+	}
+
+	cleanedPrefix, _ := cleanArchivePath(prefix)
+	if cleanedPrefix == "" {
+		return fmt.Errorf("invalid archive prefix: %s", prefix)
+	}
+
+	cleanedPrefix = fixDirSlash(true, cleanedPrefix)
+
+	for key, item := range _zipFilePathListMap {
+		item.relativeFilePath = filepath.Join(filepath.FromSlash(cleanedPrefix), item.relativeFilePath)
+		item.relativeFilePath = fixDirSlash(item.isDir, item.relativeFilePath)
+
+		_zipFilePathListMap[key] = item
+	}
+
+	addArchiveParentDirs(&_zipFilePathListMap, cleanedPrefix)
+
+	return nil
+}
+
+// adds a directory entry for the directory [archivePath] and each of its parents which aren't in the list yet
+func addArchiveParentDirs(zipFilePathListMap *map[string]createArchiveFileInfo, archivePath string) {
+	_zipFilePathListMap := *zipFilePathListMap
+
+	archivePathKeys := make(map[string]bool)
+	for _, item := range _zipFilePathListMap {
+		archivePathKeys[archivePathKey(item.relativeFilePath)] = true
+	}
+
+	splittedPaths := strings.Split(strings.TrimSuffix(filepath.ToSlash(archivePath), "/"), "/")
+
+	for pathIndex := range splittedPaths {
+		dirPath := strings.Join(splittedPaths[:pathIndex+1], "/")
+
+		if archivePathKeys[dirPath] {
+			continue
+		}
+
+		name := fixDirSlash(true, dirPath)
+
+		var fileInfo os.FileInfo = virtualFileInfo{
+			name:    name,
+			mode:    os.ModeDir | 0755,
+			modTime: time.Now(),
+		}
+
+		_zipFilePathListMap[fmt.Sprintf("%s%s", virtualFileKeyPrefix, name)] = createArchiveFileInfo{
+			absFilepath:      name,
+			relativeFilePath: filepath.FromSlash(name),
+			isDir:            true,
+			fileInfo:         &fileInfo,
+			virtualFile:      &VirtualFile{Name: name},
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package onearchiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a data region of a sparse file; the rest of the file is made up of holes
+type sparseRegion struct {
+	offset, length int64
+}
+
+// writes [header] and the data regions of [file] as a gnu pax 1.0 sparse entry, the holes are left out
+// [tar.Writer] drops the GNU.sparse.* records of [tar.Header.PAXRecords], hence the pax extended header is encoded here;
+// the entry itself, which holds the sparse map and the data regions, is written through [tw]
+func writeSparseTarEntry(tw *tarballWriter, header *tar.Header, file *os.File, regions []sparseRegion) error {
+	realSize := header.Size
+
+	// a trailing hole is recorded as a zero-length region at the end of the file
+	entries := append([]sparseRegion{}, regions...)
+	if len(entries) < 1 || entries[len(entries)-1].offset+entries[len(entries)-1].length < realSize {
+		entries = append(entries, sparseRegion{offset: realSize})
+	}
+
+	var sparseMap bytes.Buffer
+	_, _ = fmt.Fprintf(&sparseMap, "%d\n", len(entries))
+
+	dataSize := int64(0)
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(&sparseMap, "%d\n%d\n", entry.offset, entry.length)
+
+		dataSize += entry.length
+	}
+
+	sparseMap.Write(make([]byte, tarPadding(int64(sparseMap.Len()))))
+
+	// the size of the entry is kept in the ustar header, as a size record would have to go into a pax header of its own
+	if int64(sparseMap.Len())+dataSize > maxUSTARNumber {
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		_, err := io.Copy(tw, newProgressReader(io.NewSectionReader(file, 0, realSize), tw.onRead))
+
+		return err
+	}
+
+	records := make(map[string]string)
+
+	for key, value := range header.PAXRecords {
+		records[key] = value
+	}
+
+	records["GNU.sparse.major"] = "1"
+	records["GNU.sparse.minor"] = "0"
+	records["GNU.sparse.name"] = header.Name
+	records["GNU.sparse.realsize"] = strconv.FormatInt(realSize, 10)
+	records["mtime"] = formatPAXTime(header.ModTime)
+
+	if !header.AccessTime.IsZero() {
+		records["atime"] = formatPAXTime(header.AccessTime)
+	}
+
+	if !header.ChangeTime.IsZero() {
+		records["ctime"] = formatPAXTime(header.ChangeTime)
+	}
+
+	// the ustar header holds what fits into it, the records take precedence over it
+	sparseHeader := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     ustarPlaceholderName(path.Join(path.Dir(header.Name), "GNUSparseFile.0", path.Base(header.Name))),
+		Mode:     header.Mode,
+		Size:     int64(sparseMap.Len()) + dataSize,
+		Format:   tar.FormatUSTAR,
+	}
+
+	if modTime := header.ModTime.Unix(); modTime >= 0 && modTime <= maxUSTARNumber {
+		sparseHeader.ModTime = time.Unix(modTime, 0)
+	} else {
+		sparseHeader.ModTime = time.Unix(0, 0)
+	}
+
+	if header.Uid >= 0 && header.Uid <= maxUSTARId {
+		sparseHeader.Uid = header.Uid
+	} else {
+		records["uid"] = strconv.Itoa(header.Uid)
+	}
+
+	if header.Gid >= 0 && header.Gid <= maxUSTARId {
+		sparseHeader.Gid = header.Gid
+	} else {
+		records["gid"] = strconv.Itoa(header.Gid)
+	}
+
+	if isUSTARUserName(header.Uname) {
+		sparseHeader.Uname = header.Uname
+	} else {
+		records["uname"] = header.Uname
+	}
+
+	if isUSTARUserName(header.Gname) {
+		sparseHeader.Gname = header.Gname
+	} else {
+		records["gname"] = header.Gname
+	}
+
+	paxHeaderName := ustarPlaceholderName(path.Join(path.Dir(header.Name), "PaxHeaders.0", path.Base(header.Name)))
+
+	// pads the previous entry before the pax header is written past [tar.Writer]
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := tw.out.Write(encodePAXHeader(paxHeaderName, records)); err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(sparseHeader); err != nil {
+		return err
+	}
+
+	if _, err := tw.Write(sparseMap.Bytes()); err != nil {
+		return err
+	}
+
+	for _, region := range regions {
+		if _, err := io.Copy(tw, newProgressReader(io.NewSectionReader(file, region.offset, region.length), tw.onRead)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodes the pax extended header of the next entry; [name] has to fit into a ustar header
+func encodePAXHeader(name string, records map[string]string) []byte {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var data bytes.Buffer
+	for _, key := range keys {
+		data.WriteString(formatPAXRecord(key, records[key]))
+	}
+
+	block := make([]byte, blockSize)
+
+	copy(block[0:100], name)
+	formatTarOctal(block[100:108], 0)
+	formatTarOctal(block[108:116], 0)
+	formatTarOctal(block[116:124], 0)
+	formatTarOctal(block[124:136], int64(data.Len()))
+	formatTarOctal(block[136:148], 0)
+	block[156] = tar.TypeXHeader
+	copy(block[257:265], "ustar\x0000")
+
+	// the checksum is summed up with its own field filled with spaces
+	copy(block[148:156], "        ")
+
+	checksum := int64(0)
+	for _, b := range block {
+		checksum += int64(b)
+	}
+
+	formatTarOctal(block[148:155], checksum)
+	block[155] = ' '
+
+	encodedHeader := append(block, data.Bytes()...)
+
+	return append(encodedHeader, make([]byte, tarPadding(int64(data.Len())))...)
+}
+
+// a record is prefixed by its own length in bytes, including the length itself
+func formatPAXRecord(key string, value string) string {
+	// the space, the equal sign and the newline
+	size := len(key) + len(value) + 3
+	size += len(strconv.Itoa(size))
+
+	record := fmt.Sprintf("%d %s=%s\n", size, key, value)
+
+	// the length took one more digit than expected
+	if len(record) != size {
+		record = fmt.Sprintf("%d %s=%s\n", len(record), key, value)
+	}
+
+	return record
+}
+
+// formats [t] as seconds with a fraction; the times before the epoch are negative as a whole, e.g. -1.5
+func formatPAXTime(t time.Time) string {
+	seconds, nanoseconds := t.Unix(), int64(t.Nanosecond())
+	if nanoseconds == 0 {
+		return strconv.FormatInt(seconds, 10)
+	}
+
+	sign := ""
+	if seconds < 0 {
+		sign = "-"
+		seconds = -(seconds + 1)
+		nanoseconds = 1e9 - nanoseconds
+	}
+
+	return strings.TrimRight(fmt.Sprintf("%s%d.%09d", sign, seconds, nanoseconds), "0")
+}
+
+// writes [value] as zero padded octal digits followed by a NUL
+func formatTarOctal(field []byte, value int64) {
+	digits := strconv.FormatInt(value, 8)
+	if padding := len(field) - len(digits) - 1; padding > 0 {
+		digits = strings.Repeat("0", padding) + digits
+	}
+
+	copy(field, digits+"\x00")
+}
+
+// cuts [name] down to its ascii characters and to the name field of a ustar header, keeping its end
+// used for the names which are overridden by a pax record
+func ustarPlaceholderName(name string) string {
+	var asciiName strings.Builder
+
+	for _, c := range name {
+		if c > 0 && c < 0x80 {
+			asciiName.WriteRune(c)
+		}
+	}
+
+	name = asciiName.String()
+
+	if len(name) > 99 {
+		name = name[len(name)-99:]
+	}
+
+	return strings.TrimLeft(name, "/")
+}
+
+func isUSTARUserName(name string) bool {
+	if len(name) > 31 {
+		return false
+	}
+
+	for _, c := range name {
+		if c >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// returns the number of bytes padding [size] up to a whole tar block
+func tarPadding(size int64) int64 {
+	return -size & (blockSize - 1)
+}
+
+// checks whether the entry was written as a gnu sparse file
+func isSparseTarHeader(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, paxGNUSparsePrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copies [r] into [file] leaving the blocks of zeros unwritten, so that the filesystem keeps them as holes
+// returns the number of bytes copied
+func writeSparseFile(file *os.File, r io.Reader) (int64, error) {
+	buf := make([]byte, sparseHoleSize)
+	offset := int64(0)
+
+	for {
+		n, err := io.ReadFull(r, buf)
+
+		if n > 0 && !isZeroFilled(buf[:n]) {
+			if _, err := file.WriteAt(buf[:n], offset); err != nil {
+				return offset, err
+			}
+		}
+
+		offset += int64(n)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return offset, err
+		}
+	}
+
+	// extends the file over the trailing hole
+	return offset, file.Truncate(offset)
+}
+
+func isZeroFilled(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
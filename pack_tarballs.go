@@ -1,68 +1,138 @@
 package onearchiver
 
 import (
+	"archive/tar"
 	"fmt"
-	"github.com/ganeshrvel/archiver"
+	"io"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 )
 
-func packTarballs(arc *commonArchive, arcFileObj interface{ archiver.Writer }, fileList *[]string, commonParentPath string, ph *ProgressHandler) error {
+func packTarballs(arc *commonArchive, arcFileObj interface{}, fileList *[]string, commonParentPath string, ph *ProgressHandler) error {
 	_filename := arc.meta.Filename
-	_gitIgnorePattern := arc.meta.GitIgnorePattern
 
-	out, err := os.Create(_filename)
+	out, err := createPackingOutput(_filename, arc.pack.VolumeSize)
 	if err != nil {
 		return err
 	}
 
-	err = arcFileObj.Create(out)
+	// the existing tarball is only replaced once the new one is written in full
+	if err := writeTarballEnvelope(arc, arcFileObj, out, fileList, commonParentPath, ph); err != nil {
+		out.abort()
+
+		return err
+	}
+
+	return out.Close()
+}
+
+// writes the tarball into [out] wrapped in the encrypted envelope if [ArchiveMeta.hasEnvelope]; [out] is left open
+func writeTarballEnvelope(arc *commonArchive, arcFileObj interface{}, out io.Writer, fileList *[]string, commonParentPath string, ph *ProgressHandler) error {
+	envelope, err := newEnvelopeWriter(newContextWriter(arc.ctx, out), &arc.meta)
+	if err != nil {
+		return err
+	}
+
+	if err := writeTarball(arc, arcFileObj, envelope, fileList, commonParentPath, ph); err != nil {
+		return err
+	}
+
+	return envelope.Close()
+}
+
+// writes the tarball of the format [arcFileObj] into [out]; [out] is left open
+func writeTarball(arc *commonArchive, arcFileObj interface{}, out io.Writer, fileList *[]string, commonParentPath string, ph *ProgressHandler) error {
+	_compression := arc.pack.Compression
+
+	compressor, err := newCompressor(arcFileObj, out, &_compression)
 	if err != nil {
 		return err
 	}
 
+	tarWriter := newTarballWriter(compressor, &arc.pack)
+
 	zipFilePathListMap := make(map[string]createArchiveFileInfo)
 
-	err = processFilesForPacking(&zipFilePathListMap, fileList, commonParentPath, &_gitIgnorePattern)
+	err = collectFilesForPacking(&zipFilePathListMap, &arc.meta, &arc.pack, fileList, commonParentPath, true, nil)
 	if err != nil {
 		return err
 	}
 
 	totalFiles := len(zipFilePathListMap)
-	pInfo, ch := initProgress(totalFiles, ph)
+	pInfo, ch := initProgress(totalFiles, packingTotalBytes(zipFilePathListMap), ph)
+
+	tarWriter.onRead = pInfo.byteCounter(ch)
 
 	count := 0
-	for absolutePath, item := range zipFilePathListMap {
+	for _, item := range sortedPackingFileList(zipFilePathListMap) {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
 		count += 1
-		pInfo.progress(ch, totalFiles, absolutePath, count)
+		pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(&item))
 
-		if err := addFileToTarBall(&arcFileObj, *item.fileInfo, item.absFilepath, item.relativeFilePath, item.isDir)
-			err != nil {
+		if err := addFileToTarBall(tarWriter, &arc.pack, &item); err != nil {
 			return err
 		}
 	}
 
 	pInfo.endProgress(ch, totalFiles)
 
-	defer func() {
-		if err := arcFileObj.Close(); err != nil {
-			fmt.Println(err)
-		}
-	}()
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
 
-	return err
+	return compressor.Close()
 }
 
-func addFileToTarBall(arcFileObj *interface{ archiver.Writer }, fileInfo os.FileInfo, filename string, relativeFilename string, isDir bool) error {
-	_arcFileObj := *arcFileObj
+// [tar.Writer] along with the stream it writes into, for the entries which [tar.Writer] can't encode on its own
+type tarballWriter struct {
+	*tar.Writer
+
+	out       io.Writer
+	hardLinks *hardLinkTracker
 
-	_relativeFilename := relativeFilename
+	// reports the bytes of the files as they are read; can be nil
+	onRead func(int)
+}
 
-	if isDir {
-		_relativeFilename = strings.TrimRight(_relativeFilename, PathSep)
+func newTarballWriter(out io.Writer, pack *ArchivePack) *tarballWriter {
+	return &tarballWriter{
+		Writer:    tar.NewWriter(out),
+		out:       out,
+		hardLinks: newHardLinkTracker(pack),
 	}
+}
 
-	fileToArchive, err := os.Open(filename)
+func addFileToTarBall(tarWriter *tarballWriter, pack *ArchivePack, item *createArchiveFileInfo) error {
+	header, err := tar.FileInfoHeader(*item.fileInfo, filepath.ToSlash(item.linkTarget))
+	if err != nil {
+		return err
+	}
+
+	header.Name = filepath.ToSlash(fixDirSlash(item.isDir, item.relativeFilePath))
+
+	if pack.Reproducible {
+		normalizeTarHeader(header, (*item.fileInfo).Mode(), pack.sourceDateEpoch())
+	} else if pack.PreserveMetadata {
+		if err := addTarMetadata(header, item); err != nil {
+			return err
+		}
+	}
+
+	linkName, isHardLink := tarWriter.hardLinks.linkName(item)
+	if isHardLink {
+		setTarHardLink(header, linkName)
+	}
+
+	// directories, symlinks and hard links have no contents
+	if item.isDir || item.linkTarget != "" || isHardLink {
+		return tarWriter.WriteHeader(header)
+	}
+
+	fileToArchive, err := item.open()
 	if err != nil {
 		return err
 	}
@@ -73,14 +143,31 @@ func addFileToTarBall(arcFileObj *interface{ archiver.Writer }, fileInfo os.File
 		}
 	}()
 
-	err = _arcFileObj.Write(archiver.File{
-		FileInfo: archiver.FileInfo{
-			FileInfo:   fileInfo,
-			CustomName: _relativeFilename,
-		},
-		OriginalPath: filename,
-		ReadCloser:   fileToArchive,
-	})
+	// the holes depend on the filesystem, hence they are not looked for while packing reproducibly
+	if osFile, ok := fileToArchive.(*os.File); ok && pack.DetectSparseFiles && !pack.Reproducible {
+		if regions, ok := sparseDataRegions(osFile, *item.fileInfo); ok {
+			return writeSparseTarEntry(tarWriter, header, osFile, regions)
+		}
+	}
+
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tarWriter, newProgressReader(fileToArchive, tarWriter.onRead))
 
 	return err
 }
+
+// strips the machine and the time dependent fields off the header
+func normalizeTarHeader(header *tar.Header, mode os.FileMode, modTime time.Time) {
+	header.Mode = int64(reproducibleFileMode(mode).Perm())
+	header.ModTime = modTime
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	header.PAXRecords = nil
+}
@@ -0,0 +1,275 @@
+package onearchiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"github.com/ganeshrvel/archiver"
+	"io"
+	"os"
+)
+
+// adds the new and the changed files to an existing tarball
+// uncompressed tarballs are appended to as long as none of the archived files has changed, without reading their entries again;
+// everything else is rewritten as a stream
+func updateTarball(arc *commonArchive, arcFileObj interface{}, fileList *[]string, commonParentPath string, ph *ProgressHandler) error {
+	_filename := arc.meta.Filename
+
+	zipFilePathListMap := make(map[string]createArchiveFileInfo)
+
+	err := collectFilesForPacking(&zipFilePathListMap, &arc.meta, &arc.pack, fileList, commonParentPath, true, nil)
+	if err != nil {
+		return err
+	}
+
+	packingFileList := packingFileListByArchivePath(zipFilePathListMap)
+
+	if _, ok := arcFileObj.(*archiver.Tar); ok {
+		endOffset, archivedKeys, changed, err := scanTarballForUpdate(_filename, packingFileList)
+		if err != nil {
+			return err
+		}
+
+		if !changed {
+			return appendToTarball(arc, endOffset, archivedKeys, packingFileList, ph)
+		}
+	}
+
+	return rewriteTarball(arc, arcFileObj, packingFileList, ph)
+}
+
+// returns the offset of the end-of-archive marker, the keys of the files which are already archived
+// and whether any of the archived files has changed
+func scanTarballForUpdate(filename string, packingFileList map[string]createArchiveFileInfo) (int64, map[string]bool, bool, error) {
+	archivedKeys := make(map[string]bool)
+	archivedSizes := make(map[string]int64)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, archivedKeys, false, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	// [tar.Reader] seeks over the file contents when it reads from an [os.File]
+	tarReader := tar.NewReader(file)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return 0, archivedKeys, false, err
+		}
+
+		key := archivePathKey(header.Name)
+		archivedSizes[key] = archivedTarEntrySize(header, archivedSizes)
+
+		if item, ok := packingFileList[key]; ok {
+			if isPackingFileChanged(&item, archivedSizes[key], header.ModTime, tarModTimePrecision) {
+				return 0, archivedKeys, true, nil
+			}
+
+			archivedKeys[key] = true
+		}
+	}
+
+	// the reader stops right after the two zero blocks which mark the end of the archive
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, archivedKeys, false, err
+	}
+
+	return offset - 2*blockSize, archivedKeys, false, nil
+}
+
+// the archived entries are copied into a temp file next to the tarball, which takes the new entries and is renamed over the tarball;
+// the tarball is left as it was until then
+func appendToTarball(arc *commonArchive, endOffset int64, archivedKeys map[string]bool, packingFileList map[string]createArchiveFileInfo, ph *ProgressHandler) error {
+	_filename := arc.meta.Filename
+
+	return replaceViaTempFile(_filename, func(out *os.File) error {
+		in, err := os.Open(_filename)
+		if err != nil {
+			return err
+		}
+
+		// the new entries take the place of the end-of-archive marker, hence it is left out
+		_, err = io.Copy(newContextWriter(arc.ctx, out), io.NewSectionReader(in, 0, endOffset))
+
+		if err := in.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return writeAppendedTarEntries(arc, out, archivedKeys, packingFileList, ph)
+	})
+}
+
+func writeAppendedTarEntries(arc *commonArchive, out io.Writer, archivedKeys map[string]bool, packingFileList map[string]createArchiveFileInfo, ph *ProgressHandler) error {
+	// the files which are already archived are not tracked, hence only the new files are linked to each other
+	tarWriter := newTarballWriter(newContextWriter(arc.ctx, out), &arc.pack)
+
+	totalFiles := len(packingFileList)
+	pInfo, ch := initProgress(totalFiles, packingTotalBytes(packingFileList), ph)
+
+	tarWriter.onRead = pInfo.byteCounter(ch)
+
+	count := 0
+	for _, item := range sortedPackingFileList(packingFileList) {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
+		count += 1
+		pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(&item))
+
+		if archivedKeys[archivePathKey(item.relativeFilePath)] {
+			continue
+		}
+
+		if err := addFileToTarBall(tarWriter, &arc.pack, &item); err != nil {
+			return err
+		}
+	}
+
+	pInfo.endProgress(ch, totalFiles)
+
+	return tarWriter.Close()
+}
+
+func rewriteTarball(arc *commonArchive, arcFileObj interface{}, packingFileList map[string]createArchiveFileInfo, ph *ProgressHandler) error {
+	_filename := arc.meta.Filename
+
+	return replaceViaTempFile(_filename, func(out *os.File) error {
+		in, err := os.Open(_filename)
+		if err != nil {
+			return err
+		}
+
+		err = rewriteTarEntries(arc, arcFileObj, in, out, packingFileList, ph)
+
+		if err := in.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+
+		return err
+	})
+}
+
+// copies the entries of the tarball [in] into [out], along with the new and the changed files of [packingFileList]
+func rewriteTarEntries(arc *commonArchive, arcFileObj interface{}, in io.Reader, out io.Writer, packingFileList map[string]createArchiveFileInfo, ph *ProgressHandler) error {
+	_compression := arc.pack.Compression
+
+	decompressor, err := newDecompressor(arcFileObj, in)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(decompressor)
+
+	compressor, err := newCompressor(arcFileObj, newContextWriter(arc.ctx, out), &_compression)
+	if err != nil {
+		return err
+	}
+
+	tarWriter := newTarballWriter(compressor, &arc.pack)
+
+	totalFiles := len(packingFileList)
+	pInfo, ch := initProgress(totalFiles, packingTotalBytes(packingFileList), ph)
+
+	tarWriter.onRead = pInfo.byteCounter(ch)
+
+	archivedSizes := make(map[string]int64)
+
+	count := 0
+	for {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		key := archivePathKey(header.Name)
+		archivedSizes[key] = archivedTarEntrySize(header, archivedSizes)
+
+		if item, ok := packingFileList[key]; ok {
+			// the changed files are written afresh below
+			if isPackingFileChanged(&item, archivedSizes[key], header.ModTime, tarModTimePrecision) {
+				continue
+			}
+
+			delete(packingFileList, key)
+
+			count += 1
+			pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(&item))
+		}
+
+		// [tar.Reader] expands the sparse files, hence they are written back as regular files
+		if header.Typeflag == tar.TypeGNUSparse {
+			header.Typeflag = tar.TypeReg
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(tarWriter, tarReader); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range sortedPackingFileList(packingFileList) {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
+		count += 1
+		pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(&item))
+
+		if err := addFileToTarBall(tarWriter, &arc.pack, &item); err != nil {
+			return err
+		}
+	}
+
+	pInfo.endProgress(ch, totalFiles)
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+
+	return decompressor.Close()
+}
+
+// size to compare against the file on the disk; the symlinks are compared by their target
+// the hard links take the size of the entry they link to from [archivedSizes]
+func archivedTarEntrySize(header *tar.Header, archivedSizes map[string]int64) int64 {
+	if header.Typeflag == tar.TypeSymlink {
+		return int64(len(header.Linkname))
+	}
+
+	if header.Typeflag == tar.TypeLink {
+		return archivedSizes[archivePathKey(header.Linkname)]
+	}
+
+	return header.Size
+}
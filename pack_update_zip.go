@@ -0,0 +1,149 @@
+package onearchiver
+
+import (
+	stdzip "archive/zip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rewrites the zip file with the new and the changed files
+// the untouched entries are copied over as raw compressed data
+func updateZipFile(arc *zipArchive, fileList []string, commonParentPath string, ph *ProgressHandler) error {
+	_filename := arc.meta.Filename
+	_password := arc.meta.Password
+
+	if _password != "" {
+		return fmt.Errorf("updating an encrypted zip archive is not supported")
+	}
+
+	zipFilePathListMap := make(map[string]createArchiveFileInfo)
+
+	err := collectFilesForPacking(&zipFilePathListMap, &arc.meta, &arc.pack, &fileList, commonParentPath, false, nil)
+	if err != nil {
+		return err
+	}
+
+	return replaceViaTempFile(_filename, func(out *os.File) error {
+		reader, err := stdzip.OpenReader(_filename)
+		if err != nil {
+			return err
+		}
+
+		err = writeUpdatedZipFile(arc, &reader.Reader, zipFilePathListMap, out, ph)
+
+		if err := reader.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+
+		return err
+	})
+}
+
+// copies the entries of [reader] into [out], along with the new and the changed files of [zipFilePathListMap]
+func writeUpdatedZipFile(arc *zipArchive, reader *stdzip.Reader, zipFilePathListMap map[string]createArchiveFileInfo, out io.Writer, ph *ProgressHandler) error {
+	_compression := arc.pack.Compression
+
+	zipWriter := newRegularZipWriter(newContextWriter(arc.ctx, out), &_compression)
+
+	comment := reader.Comment
+	if arc.pack.Comment != "" {
+		comment = arc.pack.Comment
+	}
+
+	if err := zipWriter.SetComment(comment); err != nil {
+		return err
+	}
+
+	packingFileList := packingFileListByArchivePath(zipFilePathListMap)
+
+	totalFiles := len(zipFilePathListMap)
+	pInfo, ch := initProgress(totalFiles, packingTotalBytes(zipFilePathListMap), ph)
+
+	count := 0
+	for _, file := range reader.File {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
+		key := archivePathKey(file.Name)
+
+		// the comment set for a kept entry takes the place of its archived comment
+		comment := ""
+
+		if item, ok := packingFileList[key]; ok {
+			// the changed files are written afresh below
+			if isPackingFileChanged(&item, int64(file.UncompressedSize64), file.Modified, zipModTimePrecision) {
+				continue
+			}
+
+			delete(packingFileList, key)
+
+			count += 1
+			pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(&item))
+
+			comment = arc.pack.entryComment(&item)
+		}
+
+		if comment != "" {
+			if err := copyZipEntryWithComment(zipWriter, file, comment); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := zipWriter.Copy(file); err != nil {
+			return err
+		}
+	}
+
+	if arc.pack.Workers > 1 {
+		err := addFilesToRegularZipInParallel(arc.ctx, zipWriter, &arc.pack, sortedPackingFileList(packingFileList), func(item *createArchiveFileInfo) {
+			count += 1
+			pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(item))
+		}, pInfo.parallelByteCounter(ch))
+		if err != nil {
+			return err
+		}
+	} else {
+		onRead := pInfo.byteCounter(ch)
+
+		for _, item := range sortedPackingFileList(packingFileList) {
+			if err := checkContext(arc.ctx); err != nil {
+				return err
+			}
+
+			count += 1
+			pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(&item))
+
+			if err := addFileToRegularZip(arc.ctx, zipWriter, &arc.pack, &item, onRead); err != nil {
+				return err
+			}
+		}
+	}
+
+	pInfo.endProgress(ch, totalFiles)
+
+	return zipWriter.Close()
+}
+
+// copies the raw compressed data of [file] like [stdzip.Writer.Copy], with [comment] in place of its comment
+func copyZipEntryWithComment(zipWriter *stdzip.Writer, file *stdzip.File, comment string) error {
+	header := file.FileHeader
+	header.Comment = comment
+
+	writer, err := zipWriter.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+
+	reader, err := file.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, reader)
+
+	return err
+}
@@ -0,0 +1,144 @@
+package onearchiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// [os.FileInfo] of a [VirtualFile]
+type virtualFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi virtualFileInfo) Name() string {
+	return path.Base(fi.name)
+}
+
+func (fi virtualFileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi virtualFileInfo) Mode() os.FileMode {
+	return fi.mode
+}
+
+func (fi virtualFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+
+func (fi virtualFileInfo) IsDir() bool {
+	return fi.mode.IsDir()
+}
+
+func (fi virtualFileInfo) Sys() interface{} {
+	return nil
+}
+
+// adds the [virtualFiles] to the files to pack
+// tarballs require the size of an entry upfront, set [requireSize] to buffer the readers of unknown size in the memory
+func processVirtualFilesForPacking(zipFilePathListMap *map[string]createArchiveFileInfo, virtualFiles []VirtualFile, requireSize bool) error {
+	_zipFilePathListMap := *zipFilePathListMap
+
+	if len(virtualFiles) < 1 {
+		return nil
+	}
+
+	// the in-memory files replace the files on the disk which end up at the same path inside the archive
+	archivePathKeys := make(map[string]string)
+	for key, item := range _zipFilePathListMap {
+		archivePathKeys[archivePathKey(item.relativeFilePath)] = key
+	}
+
+	for _, virtualFile := range virtualFiles {
+		_virtualFile := virtualFile
+
+		name, isDir := cleanArchivePath(_virtualFile.Name)
+		if name == "" {
+			return fmt.Errorf("invalid virtual file name: %s", _virtualFile.Name)
+		}
+
+		size := int64(len(_virtualFile.Bytes))
+
+		if _virtualFile.Reader != nil {
+			size = _virtualFile.Size
+
+			if size == 0 && requireSize && !isDir {
+				fileBytes, err := ioutil.ReadAll(_virtualFile.Reader)
+				if err != nil {
+					return err
+				}
+
+				_virtualFile.Bytes = fileBytes
+				_virtualFile.Reader = nil
+				size = int64(len(fileBytes))
+			}
+		}
+
+		mode := _virtualFile.Mode.Perm()
+		if mode == 0 {
+			mode = 0644
+
+			if isDir {
+				mode = 0755
+			}
+		}
+
+		if isDir {
+			mode |= os.ModeDir
+		}
+
+		modTime := _virtualFile.ModTime
+		if modTime.IsZero() {
+			modTime = time.Now()
+		}
+
+		var fileInfo os.FileInfo = virtualFileInfo{
+			name:    name,
+			size:    size,
+			mode:    mode,
+			modTime: modTime,
+		}
+
+		if key, ok := archivePathKeys[archivePathKey(name)]; ok {
+			delete(_zipFilePathListMap, key)
+		}
+
+		_zipFilePathListMap[fmt.Sprintf("%s%s", virtualFileKeyPrefix, name)] = createArchiveFileInfo{
+			absFilepath:      name,
+			relativeFilePath: filepath.FromSlash(name),
+			isDir:            isDir,
+			fileInfo:         &fileInfo,
+			virtualFile:      &_virtualFile,
+		}
+	}
+
+	return nil
+}
+
+// opens the contents of a file to pack; the caller has to close it
+func (item *createArchiveFileInfo) open() (io.ReadCloser, error) {
+	if item.virtualFile == nil {
+		return os.Open(item.absFilepath)
+	}
+
+	// the reader is owned by the caller of [StartPacking], hence it's not closed here
+	if item.virtualFile.Reader != nil {
+		return ioutil.NopCloser(item.virtualFile.Reader), nil
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(item.virtualFile.Bytes)), nil
+}
+
+// checks whether the contents of the file can be read more than once
+func (item *createArchiveFileInfo) isReopenable() bool {
+	return item.virtualFile == nil || item.virtualFile.Reader == nil
+}
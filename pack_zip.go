@@ -1,74 +1,198 @@
 package onearchiver
 
 import (
+	stdzip "archive/zip"
+	"compress/flate"
+	"context"
 	"fmt"
 	"github.com/yeka/zip"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func createZipFile(arc *zipArchive, fileList []string, commonParentPath string, ph *ProgressHandler) error {
 	_filename := arc.meta.Filename
-	_password := arc.meta.Password
-	_gitIgnorePattern := arc.meta.GitIgnorePattern
-	_encryptionMethod := arc.meta.EncryptionMethod
 
-	newZipFile, err := os.Create(_filename)
+	newZipFile, err := createPackingOutput(_filename, arc.pack.VolumeSize)
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		if err := newZipFile.Close(); err != nil {
-			fmt.Printf("%v\n", err)
+	// the existing zip file is only replaced once the new one is written in full
+	if err := writeZipFile(arc, newZipFile, fileList, commonParentPath, ph); err != nil {
+		newZipFile.abort()
+
+		return err
+	}
+
+	// the volumes of a split zip file are renamed in place on close
+	return newZipFile.Close()
+}
+
+// writes the zip file into [out]; [out] is left open
+// the entries are written with data descriptors, hence [out] doesn't have to be seekable
+func writeZipFile(arc *zipArchive, out io.Writer, fileList []string, commonParentPath string, ph *ProgressHandler) error {
+	_password := arc.meta.Password
+	_encryptionMethod := arc.meta.EncryptionMethod
+	_compression := arc.pack.Compression
+
+	out = newContextWriter(arc.ctx, out)
+
+	// yeka package is only required for writing the encrypted entries,
+	// regular zip files are written using [archive/zip] which allows configuring the compressor
+	var regularZipWriter *stdzip.Writer
+	var encryptedZipWriter *zip.Writer
+
+	if _password == "" {
+		regularZipWriter = newRegularZipWriter(out, &_compression)
+
+		if err := regularZipWriter.SetComment(arc.pack.Comment); err != nil {
+			return err
+		}
+	} else {
+		// yeka package doesn't allow setting the comments
+		if arc.pack.Comment != "" || len(arc.pack.EntryComments) > 0 {
+			return fmt.Errorf("comments are not supported for the encrypted zip files")
+		}
+
+		// yeka package always deflates the encrypted entries
+		if arc.pack.CompressionMethodFunc != nil {
+			return fmt.Errorf("compression methods are not supported for the encrypted zip files")
 		}
-	}()
 
-	zipWriter := zip.NewWriter(newZipFile)
+		encryptedZipWriter = newEncryptedZipWriter(out, &_compression)
+	}
 
 	zipFilePathListMap := make(map[string]createArchiveFileInfo)
 
-	err = processFilesForPacking(&zipFilePathListMap, &fileList, commonParentPath, &_gitIgnorePattern)
+	err := collectFilesForPacking(&zipFilePathListMap, &arc.meta, &arc.pack, &fileList, commonParentPath, false, nil)
 	if err != nil {
 		return err
 	}
 
-	totalFiles := len(zipFilePathListMap)
-	pInfo, ch := initProgress(totalFiles, ph)
+	packingFileList := sortedPackingFileList(zipFilePathListMap)
+
+	totalFiles := len(packingFileList)
+	pInfo, ch := initProgress(totalFiles, packingTotalBytes(zipFilePathListMap), ph)
 
 	count := 0
-	for absolutePath, item := range zipFilePathListMap {
+
+	// the workers read the files concurrently, hence the bytes are counted across all of them
+	if _password == "" && arc.pack.Workers > 1 {
+		err := addFilesToRegularZipInParallel(arc.ctx, regularZipWriter, &arc.pack, packingFileList, func(item *createArchiveFileInfo) {
+			count += 1
+			pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(item))
+		}, pInfo.parallelByteCounter(ch))
+		if err != nil {
+			return err
+		}
+
+		pInfo.endProgress(ch, totalFiles)
+
+		return regularZipWriter.Close()
+	}
+
+	onRead := pInfo.byteCounter(ch)
+
+	for _, item := range packingFileList {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
 		count += 1
-		pInfo.progress(ch, totalFiles, absolutePath, count)
+		pInfo.progress(ch, totalFiles, item.absFilepath, count, packingFileSize(&item))
 
 		if _password == "" {
-			if err := addFileToRegularZip(zipWriter, *item.fileInfo, item.absFilepath, item.relativeFilePath); err != nil {
+			if err := addFileToRegularZip(arc.ctx, regularZipWriter, &arc.pack, &item, onRead); err != nil {
+				return err
+			}
+		} else if item.linkTarget != "" {
+			if err := addSymlinkToEncryptedZip(encryptedZipWriter, &item); err != nil {
 				return err
 			}
-		} else if err := addFileToEncryptedZip(zipWriter, item.absFilepath, item.relativeFilePath, _password, _encryptionMethod); err != nil {
+		} else if err := addFileToEncryptedZip(encryptedZipWriter, &item, _password, _encryptionMethod, onRead); err != nil {
 			return err
 		}
 	}
 
 	pInfo.endProgress(ch, totalFiles)
 
-	defer func() {
-		if err := zipWriter.Close(); err != nil {
-			fmt.Println(err)
-		}
-	}()
+	if _password == "" {
+		return regularZipWriter.Close()
+	}
 
-	defer func() {
-		if err := zipWriter.Flush(); err != nil {
-			fmt.Println(err)
-		}
-	}()
+	return encryptedZipWriter.Close()
+}
 
-	return err
+func newRegularZipWriter(out io.Writer, co *CompressionOptions) *stdzip.Writer {
+	zipWriter := stdzip.NewWriter(out)
+
+	level := co.level()
+
+	zipWriter.RegisterCompressor(stdzip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+
+	return zipWriter
 }
 
-func addFileToRegularZip(zipWriter *zip.Writer, fileInfo os.FileInfo, filename string, relativeFilename string) error {
-	fileToZip, err := os.Open(filename)
+// the encrypted entries are deflated at the level of [co] too
+func newEncryptedZipWriter(out io.Writer, co *CompressionOptions) *zip.Writer {
+	zipWriter := zip.NewWriter(out)
+
+	level := co.level()
+
+	zipWriter.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+
+	return zipWriter
+}
+
+// [onRead] reports the bytes of the file as they are read; can be nil
+func addFileToRegularZip(ctx context.Context, zipWriter *stdzip.Writer, pack *ArchivePack, item *createArchiveFileInfo, onRead func(int)) error {
+	header, err := stdzip.FileInfoHeader(*item.fileInfo)
+
+	if err != nil {
+		return err
+	}
+
+	header.Name = filepath.ToSlash(item.relativeFilePath)
+	header.Comment = pack.entryComment(item)
+
+	// see http://golang.org/pkg/archive/zip/#pkg-constants
+	header.Method = zipCompressionMethod(pack, item)
+
+	if pack.Reproducible {
+		normalizeZipHeader(header, (*item.fileInfo).Mode(), pack.sourceDateEpoch())
+	}
+
+	// the symlink target is stored as the contents of the entry, with the unix symlink mode set by [stdzip.FileInfoHeader]
+	if item.linkTarget != "" {
+		header.Method = stdzip.Store
+	}
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// directories have no contents
+	if item.isDir {
+		return nil
+	}
+
+	if item.linkTarget != "" {
+		_, err = io.WriteString(writer, filepath.ToSlash(item.linkTarget))
+
+		return err
+	}
+
+	fileToZip, err := item.open()
 
 	if err != nil {
 		return err
@@ -80,30 +204,35 @@ func addFileToRegularZip(zipWriter *zip.Writer, fileInfo os.FileInfo, filename s
 		}
 	}()
 
-	header, err := zip.FileInfoHeader(fileInfo)
+	_, err = io.Copy(writer, newProgressReader(newContextReader(ctx, fileToZip), onRead))
+
+	return err
+}
+
+// symlinks are written unencrypted into the encrypted zip files, as yeka package doesn't allow setting the file mode of an encrypted entry
+func addSymlinkToEncryptedZip(zipWriter *zip.Writer, item *createArchiveFileInfo) error {
+	header, err := zip.FileInfoHeader(*item.fileInfo)
 
 	if err != nil {
 		return err
 	}
 
-	header.Name = relativeFilename
-
-	// see http://golang.org/pkg/archive/zip/#pkg-constants
-	header.Method = zip.Deflate
+	header.Name = filepath.ToSlash(item.relativeFilePath)
+	header.Method = zip.Store
 
 	writer, err := zipWriter.CreateHeader(header)
 	if err != nil {
 		return err
 	}
 
-	_, _ = io.Copy(writer, fileToZip)
+	_, err = io.WriteString(writer, filepath.ToSlash(item.linkTarget))
 
 	return err
 }
 
-func addFileToEncryptedZip(zipWriter *zip.Writer, filename string, relativeFilename string, password string,
-	encryptionMethod zip.EncryptionMethod) error {
-	fileToZip, err := os.Open(filename)
+func addFileToEncryptedZip(zipWriter *zip.Writer, item *createArchiveFileInfo, password string,
+	encryptionMethod zip.EncryptionMethod, onRead func(int)) error {
+	fileToZip, err := item.open()
 
 	if err != nil {
 		return err
@@ -115,13 +244,117 @@ func addFileToEncryptedZip(zipWriter *zip.Writer, filename string, relativeFilen
 		}
 	}()
 
-	writer, err := zipWriter.Encrypt(relativeFilename, password, encryptionMethod)
+	writer, err := zipWriter.Encrypt(filepath.ToSlash(item.relativeFilePath), password, encryptionMethod)
 
 	if err != nil {
 		return err
 	}
 
-	_, _ = io.Copy(writer, fileToZip)
+	_, err = io.Copy(writer, newProgressReader(fileToZip, onRead))
 
 	return err
 }
+
+// strips the time dependent fields off the header and normalizes the permissions
+func normalizeZipHeader(header *stdzip.FileHeader, mode os.FileMode, modTime time.Time) {
+	// dos timestamps can't go below 1980
+	if modTime.Before(minZipModTime) {
+		modTime = minZipModTime
+	}
+
+	header.Modified = modTime
+	header.SetMode(reproducibleFileMode(mode))
+}
+
+// returns the comment of [item] from [ArchivePack.EntryComments]; the directories may be keyed with or without a trailing slash
+func (pack *ArchivePack) entryComment(item *createArchiveFileInfo) string {
+	key := archivePathKey(item.relativeFilePath)
+
+	if comment, ok := pack.EntryComments[key]; ok {
+		return comment
+	}
+
+	return pack.EntryComments[key+"/"]
+}
+
+// picks the compression method of a regular zip entry
+func zipCompressionMethod(pack *ArchivePack, item *createArchiveFileInfo) uint16 {
+	if pack.CompressionMethodFunc != nil {
+		if method, ok := pack.CompressionMethodFunc(item.relativeFilePath, *item.fileInfo); ok {
+			return method
+		}
+	}
+
+	if !pack.SelectiveCompression || item.isDir {
+		return stdzip.Deflate
+	}
+
+	storedExtensions := pack.StoredExtensions
+	if storedExtensions == nil {
+		storedExtensions = DefaultStoredExtensions
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(item.relativeFilePath), ".")
+
+	if ext != "" {
+		for _, e := range storedExtensions {
+			if strings.EqualFold(e, ext) {
+				return stdzip.Store
+			}
+		}
+	}
+
+	// the readers of the in-memory files can only be consumed once
+	if item.isReopenable() && !isCompressible(item) {
+		return stdzip.Store
+	}
+
+	return stdzip.Deflate
+}
+
+type countWriter struct {
+	count int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.count += int64(len(p))
+
+	return len(p), nil
+}
+
+// deflates the head of the file to figure out whether compressing it would save any space
+// any error here is left for the actual write to report, hence the file is treated as compressible
+func isCompressible(item *createArchiveFileInfo) bool {
+	file, err := item.open()
+	if err != nil {
+		return true
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	sample, err := ioutil.ReadAll(io.LimitReader(file, compressibilityProbeSize))
+	if err != nil || len(sample) < 1 {
+		return true
+	}
+
+	cw := &countWriter{}
+
+	flateWriter, err := flate.NewWriter(cw, flate.BestSpeed)
+	if err != nil {
+		return true
+	}
+
+	if _, err := flateWriter.Write(sample); err != nil {
+		return true
+	}
+
+	if err := flateWriter.Close(); err != nil {
+		return true
+	}
+
+	return float64(cw.count) < float64(len(sample))*compressibilityProbeRatio
+}
@@ -0,0 +1,239 @@
+package onearchiver
+
+import (
+	stdzip "archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// an entry which was compressed by a worker, waiting to be copied into the zip file
+type compressedZipEntry struct {
+	item *createArchiveFileInfo
+	data *spillBuffer
+	err  error
+}
+
+// compresses [items] using [ArchivePack.Workers] goroutines and writes them into [zipWriter] in the same order
+// every entry is compressed into a single entry zip file of its own, which is then copied over as raw compressed data;
+// hence the entries come out the same as the ones written by [addFileToRegularZip]
+// [onWrite] is called once an entry is the next one to be written, before waiting on its worker; no more entries are compressed
+// once [ctx] is done
+// [onRead] is called every [progressReportInterval] while waiting on an entry, and once it is written, with the bytes read
+// by the workers so far: of all the files and of the file of the entry; both are called from the calling goroutine
+func addFilesToRegularZipInParallel(ctx context.Context, zipWriter *stdzip.Writer, pack *ArchivePack, items []createArchiveFileInfo, onWrite func(item *createArchiveFileInfo), onRead func(processedBytes int64, currentFileProcessedBytes int64)) error {
+	workers := pack.Workers
+
+	// the bytes read by the workers, in all and of every item; updated atomically as the files are compressed
+	processedBytes := int64(0)
+	itemProcessedBytes := make([]int64, len(items))
+
+	results := make([]chan compressedZipEntry, len(items))
+	for i := range results {
+		results[i] = make(chan compressedZipEntry, 1)
+	}
+
+	// limits the number of the compressed entries waiting to be written, so that a large entry at the front
+	// doesn't let the rest of the archive pile up in the memory
+	pending := make(chan struct{}, workers*2)
+	semaphore := make(chan struct{}, workers)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := range items {
+			select {
+			case pending <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			// the entry stands in for the rest of the items, which are never dispatched
+			if err := checkContext(ctx); err != nil {
+				results[i] <- compressedZipEntry{item: &items[i], data: &spillBuffer{}, err: err}
+
+				return
+			}
+
+			semaphore <- struct{}{}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+
+				results[i] <- compressZipEntry(ctx, pack, &items[i], func(n int) {
+					atomic.AddInt64(&processedBytes, int64(n))
+					atomic.AddInt64(&itemProcessedBytes[i], int64(n))
+				})
+			}(i)
+		}
+	}()
+
+	// the entries which were compressed but never written are released once the workers are done
+	defer func() {
+		close(done)
+
+		go func() {
+			wg.Wait()
+
+			for _, result := range results {
+				select {
+				case entry := <-result:
+					entry.close()
+				default:
+				}
+			}
+		}()
+	}()
+
+	reportRead := func(i int) {
+		onRead(atomic.LoadInt64(&processedBytes), atomic.LoadInt64(&itemProcessedBytes[i]))
+	}
+
+	ticker := time.NewTicker(progressReportInterval)
+	defer ticker.Stop()
+
+	for i := range items {
+		onWrite(&items[i])
+
+		var entry compressedZipEntry
+
+		for received := false; !received; {
+			select {
+			case entry = <-results[i]:
+				received = true
+			case <-ticker.C:
+				reportRead(i)
+			}
+		}
+
+		<-pending
+
+		err := writeCompressedZipEntry(zipWriter, &entry)
+		entry.close()
+
+		if err != nil {
+			return err
+		}
+
+		reportRead(i)
+	}
+
+	return nil
+}
+
+// compresses [item] into a single entry zip file; the file stops being read once [ctx] is done
+// [onRead] reports the bytes of the file as they are read; it is called from the worker
+func compressZipEntry(ctx context.Context, pack *ArchivePack, item *createArchiveFileInfo, onRead func(int)) compressedZipEntry {
+	entry := compressedZipEntry{item: item, data: &spillBuffer{}}
+
+	entryWriter := newRegularZipWriter(entry.data, &pack.Compression)
+
+	if err := addFileToRegularZip(ctx, entryWriter, pack, item, onRead); err != nil {
+		entry.err = err
+
+		return entry
+	}
+
+	entry.err = entryWriter.Close()
+
+	return entry
+}
+
+func writeCompressedZipEntry(zipWriter *stdzip.Writer, entry *compressedZipEntry) error {
+	if entry.err != nil {
+		return entry.err
+	}
+
+	reader, err := stdzip.NewReader(entry.data.readerAt(), entry.data.size)
+	if err != nil {
+		return err
+	}
+
+	if len(reader.File) != 1 {
+		return fmt.Errorf("invalid compressed zip entry: %s", entry.item.absFilepath)
+	}
+
+	return zipWriter.Copy(reader.File[0])
+}
+
+func (entry *compressedZipEntry) close() {
+	if err := entry.data.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+// keeps the written data in the memory until it grows past [parallelZipSpillSize], then spills it over to a temp file
+type spillBuffer struct {
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+func (sb *spillBuffer) Write(p []byte) (int, error) {
+	if sb.file == nil && int64(sb.buf.Len()+len(p)) > parallelZipSpillSize {
+		file, err := ioutil.TempFile("", "onearchiver-*.tmp")
+		if err != nil {
+			return 0, err
+		}
+
+		sb.file = file
+
+		if _, err := sb.file.Write(sb.buf.Bytes()); err != nil {
+			return 0, err
+		}
+
+		sb.buf = bytes.Buffer{}
+	}
+
+	var n int
+	var err error
+
+	if sb.file != nil {
+		n, err = sb.file.Write(p)
+	} else {
+		n, err = sb.buf.Write(p)
+	}
+
+	sb.size += int64(n)
+
+	return n, err
+}
+
+func (sb *spillBuffer) readerAt() io.ReaderAt {
+	if sb.file == nil {
+		return bytes.NewReader(sb.buf.Bytes())
+	}
+
+	return sb.file
+}
+
+// removes the temp file, if any
+func (sb *spillBuffer) Close() error {
+	sb.buf = bytes.Buffer{}
+
+	if sb.file == nil {
+		return nil
+	}
+
+	filename := sb.file.Name()
+
+	if err := sb.file.Close(); err != nil {
+		return err
+	}
+
+	sb.file = nil
+
+	return os.Remove(filename)
+}
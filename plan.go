@@ -0,0 +1,152 @@
+package onearchiver
+
+import (
+	"fmt"
+	ignore "github.com/sabhiram/go-gitignore"
+	"os"
+	"path/filepath"
+)
+
+// collects the files which are left out while packing along with the reason; a nil log records nothing
+type packingSkipLog struct {
+	files []SkippedFile
+}
+
+func (sl *packingSkipLog) record(absFilepath string, reason string) {
+	if sl == nil {
+		return
+	}
+
+	sl.files = append(sl.files, SkippedFile{Path: filepath.Clean(absFilepath), Reason: reason})
+}
+
+// returns the files which [StartPacking] would write into the archive and the ones it would leave out, without writing anything
+func PlanPacking(meta *ArchiveMeta, pack *ArchivePack) (PackPlan, error) {
+	_meta := *meta
+	_pack := *pack
+	_fileList := _pack.FileList
+
+	var plan PackPlan
+
+	zipFilePathListMap := make(map[string]createArchiveFileInfo)
+	skipLog := &packingSkipLog{}
+
+	err := collectFilesForPacking(&zipFilePathListMap, &_meta, &_pack, &_fileList, packingCommonParentPath(_fileList), false, skipLog)
+	if err != nil {
+		return plan, err
+	}
+
+	for _, item := range sortedPackingFileList(zipFilePathListMap) {
+		entry := PackPlanEntry{
+			ArchivePath: filepath.ToSlash(fixDirSlash(item.isDir, item.relativeFilePath)),
+			IsDir:       item.isDir,
+			LinkTarget:  filepath.ToSlash(item.linkTarget),
+		}
+
+		if item.virtualFile == nil {
+			entry.SourcePath = filepath.Clean(item.absFilepath)
+		}
+
+		if !item.isDir && item.linkTarget == "" {
+			entry.Size = (*item.fileInfo).Size()
+		}
+
+		plan.Entries = append(plan.Entries, entry)
+		plan.TotalSize += entry.Size
+	}
+
+	plan.Skipped = skipLog.files
+
+	return plan, nil
+}
+
+// returns the files which [StartUnpacking] would write and the ones it would leave out, without writing anything
+// the destination is checked for the files which would be overwritten and for the entries which can't be written
+// the entries matching [GlobalPatternDenylist] are left out of the listing, hence they aren't reported as skipped
+func PlanUnpacking(meta *ArchiveMeta, unpack *ArchiveUnpack) (UnpackPlan, error) {
+	_meta := *meta
+	_fileList := unpack.FileList
+	_destination := unpack.Destination
+
+	var plan UnpackPlan
+
+	// the ignore patterns are applied below, so that the skipped entries can be reported
+	listMeta := _meta
+	listMeta.GitIgnorePattern = nil
+
+	files, err := GetArchiveFileList(&listMeta, &ArchiveRead{Recursive: true, OrderBy: OrderByFullPath, OrderDir: OrderDirAsc})
+	if err != nil {
+		return plan, err
+	}
+
+	var ignoreList []string
+	ignoreList = append(ignoreList, GlobalPatternDenylist...)
+	ignoreList = append(ignoreList, _meta.GitIgnorePattern...)
+
+	ignoreMatches := ignore.CompileIgnoreLines(ignoreList...)
+
+	destinations := make(map[string]bool)
+
+	for _, file := range files {
+		if len(_fileList) > 0 {
+			matched := StringFilter(_fileList, func(s string) bool {
+				return subpathExists(s, fixDirSlash(file.IsDir, file.FullPath))
+			})
+
+			if len(matched) < 1 {
+				plan.Skipped = append(plan.Skipped, SkippedFile{Path: file.FullPath, Reason: "not in the file list"})
+
+				continue
+			}
+		}
+
+		if matched, ignorePattern := ignoreMatches.MatchesPathHow(file.FullPath); matched {
+			plan.Skipped = append(plan.Skipped, SkippedFile{Path: file.FullPath, Reason: fmt.Sprintf("ignore pattern %q", ignorePattern.Line)})
+
+			continue
+		}
+
+		entry := UnpackPlanEntry{
+			ArchivePath: file.FullPath,
+			Size:        file.Size,
+			IsDir:       file.IsDir,
+		}
+
+		destinationPath, err := entryDestinationPath(_destination, file.FullPath)
+		if err != nil {
+			entry.Conflict = err.Error()
+			plan.Entries = append(plan.Entries, entry)
+
+			continue
+		}
+
+		entry.DestinationPath = destinationPath
+
+		if destinations[entry.DestinationPath] {
+			entry.Conflict = "another entry is unpacked to the same path"
+		}
+
+		destinations[entry.DestinationPath] = true
+
+		if fileInfo, err := os.Lstat(entry.DestinationPath); err == nil {
+			switch {
+			case fileInfo.IsDir() && !entry.IsDir:
+				entry.Conflict = "a directory exists at the path"
+
+			case !fileInfo.IsDir() && entry.IsDir:
+				entry.Conflict = "a file exists at the path"
+
+			case !entry.IsDir:
+				entry.Overwrite = true
+			}
+		}
+
+		plan.Entries = append(plan.Entries, entry)
+
+		if !entry.IsDir {
+			plan.TotalSize += entry.Size
+		}
+	}
+
+	return plan, nil
+}
@@ -2,16 +2,19 @@ package onearchiver
 
 import (
 	rxgo "github.com/ReactiveX/RxGo"
+	"io"
+	"os"
 	"time"
 )
 
-func initProgress(totalFiles int, ph *ProgressHandler) (*ProgressInfo, *chan rxgo.Item) {
+func initProgress(totalFiles int, totalBytes int64, ph *ProgressHandler) (*ProgressInfo, *chan rxgo.Item) {
 	pInfo := ProgressInfo{
 		StartTime:          time.Now(),
 		TotalFiles:         totalFiles,
 		ProgressCount:      0,
 		CurrentFilename:    "",
 		ProgressPercentage: 0,
+		TotalBytes:         totalBytes,
 	}
 
 	ch := make(chan rxgo.Item)
@@ -29,24 +32,203 @@ func initProgress(totalFiles int, ph *ProgressHandler) (*ProgressInfo, *chan rxg
 	return &pInfo, &ch
 }
 
-func (pInfo *ProgressInfo) progress(ch *chan rxgo.Item, totalFiles int, absolutePath string, progressCount int) {
+// [fileSize] is the number of bytes of [absolutePath] which are going to be reported through [byteCounter]
+func (pInfo *ProgressInfo) progress(ch *chan rxgo.Item, totalFiles int, absolutePath string, progressCount int, fileSize int64) {
 	progressPercentage := Percent(float32(progressCount), float32(totalFiles))
 
+	// the previous file is done with, whether or not its bytes were reported
+	pInfo.completedBytes += pInfo.CurrentFileSize
+
 	pInfo.TotalFiles = totalFiles
 	pInfo.ProgressCount = progressCount
 	pInfo.CurrentFilename = absolutePath
 	pInfo.ProgressPercentage = progressPercentage
+	pInfo.CurrentFileSize = fileSize
+	pInfo.CurrentFileProcessedBytes = 0
+
+	// the parallel workers may have read past the files done with already; see [parallelByteCounter]
+	if pInfo.ProcessedBytes < pInfo.completedBytes {
+		pInfo.ProcessedBytes = pInfo.completedBytes
+	}
+
+	pInfo.updateThroughput()
 
 	*ch <- rxgo.Of(pInfo)
 }
 
+// returns a func which reports the bytes of the current file as they are processed
+// the updates are sent at most once in every [progressReportInterval]
+func (pInfo *ProgressInfo) byteCounter(ch *chan rxgo.Item) func(int) {
+	return func(n int) {
+		pInfo.CurrentFileProcessedBytes += int64(n)
+
+		processedBytes := pInfo.CurrentFileProcessedBytes
+		if processedBytes > pInfo.CurrentFileSize {
+			processedBytes = pInfo.CurrentFileSize
+		}
+
+		pInfo.ProcessedBytes = pInfo.completedBytes + processedBytes
+
+		if time.Since(pInfo.lastReportTime) < progressReportInterval {
+			return
+		}
+
+		pInfo.updateThroughput()
+
+		*ch <- rxgo.Of(pInfo)
+	}
+}
+
+// returns a func which reports the bytes read by the parallel workers of [addFilesToRegularZipInParallel]: [processedBytes] of all
+// the files and [currentFileProcessedBytes] of the current file; the updates are sent at most once in every [progressReportInterval]
+// the workers only read the files left, hence their bytes are added to the bytes of the files done with until now
+func (pInfo *ProgressInfo) parallelByteCounter(ch *chan rxgo.Item) func(int64, int64) {
+	doneBytes := pInfo.completedBytes + pInfo.CurrentFileSize
+
+	return func(processedBytes int64, currentFileProcessedBytes int64) {
+		processedBytes += doneBytes
+
+		if currentFileProcessedBytes > pInfo.CurrentFileSize {
+			currentFileProcessedBytes = pInfo.CurrentFileSize
+		}
+
+		if processedBytes > pInfo.TotalBytes {
+			processedBytes = pInfo.TotalBytes
+		}
+
+		pInfo.CurrentFileProcessedBytes = currentFileProcessedBytes
+
+		if processedBytes > pInfo.ProcessedBytes {
+			pInfo.ProcessedBytes = processedBytes
+		}
+
+		if time.Since(pInfo.lastReportTime) < progressReportInterval {
+			return
+		}
+
+		pInfo.updateThroughput()
+
+		*ch <- rxgo.Of(pInfo)
+	}
+}
+
+// reports the entry [absolutePath] of an archive whose entries aren't known upfront; see [archiveByteCounter]
+// [ProgressInfo.TotalFiles] is the number of the entries found so far
+func (pInfo *ProgressInfo) archiveProgress(ch *chan rxgo.Item, absolutePath string, progressCount int) {
+	pInfo.TotalFiles = progressCount
+	pInfo.ProgressCount = progressCount
+	pInfo.CurrentFilename = absolutePath
+
+	pInfo.updateThroughput()
+
+	*ch <- rxgo.Of(pInfo)
+}
+
+// returns a func which reports the bytes read from the archive; the percentage follows the bytes rather than the files then
+// the updates are sent at most once in every [progressReportInterval]
+func (pInfo *ProgressInfo) archiveByteCounter(ch *chan rxgo.Item) func(int) {
+	return func(n int) {
+		pInfo.ProcessedBytes += int64(n)
+		if pInfo.ProcessedBytes > pInfo.TotalBytes {
+			pInfo.ProcessedBytes = pInfo.TotalBytes
+		}
+
+		pInfo.ProgressPercentage = Percent(float32(pInfo.ProcessedBytes), float32(pInfo.TotalBytes))
+
+		if time.Since(pInfo.lastReportTime) < progressReportInterval {
+			return
+		}
+
+		pInfo.updateThroughput()
+
+		*ch <- rxgo.Of(pInfo)
+	}
+}
+
+func (pInfo *ProgressInfo) updateThroughput() {
+	pInfo.lastReportTime = time.Now()
+
+	elapsed := pInfo.lastReportTime.Sub(pInfo.StartTime).Seconds()
+	if elapsed <= 0 || pInfo.ProcessedBytes < 1 {
+		return
+	}
+
+	pInfo.BytesPerSecond = float64(pInfo.ProcessedBytes) / elapsed
+
+	remainingBytes := pInfo.TotalBytes - pInfo.ProcessedBytes
+	if remainingBytes < 0 {
+		remainingBytes = 0
+	}
+
+	pInfo.EstimatedTimeRemaining = time.Duration(float64(remainingBytes) / pInfo.BytesPerSecond * float64(time.Second))
+}
+
 func (pInfo *ProgressInfo) endProgress(ch *chan rxgo.Item, totalFiles int) {
 	pInfo.TotalFiles = totalFiles
 	pInfo.ProgressCount = totalFiles
 	pInfo.CurrentFilename = ""
 	pInfo.ProgressPercentage = 100.00
+	pInfo.ProcessedBytes = pInfo.TotalBytes
+	pInfo.CurrentFileSize = 0
+	pInfo.CurrentFileProcessedBytes = 0
+
+	pInfo.updateThroughput()
+	pInfo.EstimatedTimeRemaining = 0
 
 	*ch <- rxgo.Of(pInfo)
 
 	defer close(*ch)
 }
+
+// reports the number of bytes read through it to [onRead]
+type progressReader struct {
+	io.Reader
+
+	onRead func(int)
+}
+
+// [onRead] can be nil, [r] is returned as is then
+func newProgressReader(r io.Reader, onRead func(int)) io.Reader {
+	if onRead == nil {
+		return r
+	}
+
+	return &progressReader{Reader: r, onRead: onRead}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.Reader.Read(p)
+	if n > 0 {
+		pr.onRead(n)
+	}
+
+	return n, err
+}
+
+// number of bytes of [item] which are read while packing it
+func packingFileSize(item *createArchiveFileInfo) int64 {
+	if item.isDir || item.linkTarget != "" {
+		return 0
+	}
+
+	return (*item.fileInfo).Size()
+}
+
+// number of bytes of an archived file which are written while unpacking it
+func unpackingFileSize(fileInfo os.FileInfo) int64 {
+	if !fileInfo.Mode().IsRegular() {
+		return 0
+	}
+
+	return fileInfo.Size()
+}
+
+func packingTotalBytes(zipFilePathListMap map[string]createArchiveFileInfo) int64 {
+	totalBytes := int64(0)
+
+	for _, item := range zipFilePathListMap {
+		totalBytes += packingFileSize(&item)
+	}
+
+	return totalBytes
+}
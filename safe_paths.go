@@ -0,0 +1,181 @@
+package onearchiver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// UnsafePathError is returned while unpacking an entry which would end up outside of the destination
+type UnsafePathError struct {
+	// name of the entry as stored in the archive
+	Entry string
+
+	Reason string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe path in the archive: %s (%s)", e.Entry, e.Reason)
+}
+
+// returns the path of the entry [name] relative to the destination, with the "." and the empty elements cleaned off
+// the absolute paths, the drive letters and the ".." elements are refused; "\" is taken as a separator too,
+// as the archives written on windows may use it
+func sanitizeEntryPath(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", &UnsafePathError{Entry: name, Reason: "null byte in the path"}
+	}
+
+	slashName := strings.ReplaceAll(name, "\\", "/")
+
+	if strings.HasPrefix(slashName, "/") {
+		return "", &UnsafePathError{Entry: name, Reason: "absolute path"}
+	}
+
+	if len(slashName) > 1 && slashName[1] == ':' && isDriveLetter(slashName[0]) {
+		return "", &UnsafePathError{Entry: name, Reason: "drive letter in the path"}
+	}
+
+	for _, element := range strings.Split(slashName, "/") {
+		if element == ".." {
+			return "", &UnsafePathError{Entry: name, Reason: "path traversal"}
+		}
+	}
+
+	// "\" is left as it is, as it's a valid character of a file name on unix
+	return path.Clean(filepath.ToSlash(name)), nil
+}
+
+func isDriveLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// returns the path of the entry [name] inside [destination]; see [sanitizeEntryPath]
+func entryDestinationPath(destination string, name string) (string, error) {
+	sanitized, err := sanitizeEntryPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(destination, filepath.FromSlash(sanitized)), nil
+}
+
+// splits [filename] into its path elements relative to [destination]
+func pathElementsBeneath(destination string, filename string) ([]string, error) {
+	rel, err := filepath.Rel(destination, filename)
+	if err != nil || !isPathWithin(destination, filename) {
+		return nil, &UnsafePathError{Entry: relativeEntryPath(destination, filename), Reason: "path escapes the destination"}
+	}
+
+	if rel == "." {
+		return nil, nil
+	}
+
+	return strings.Split(rel, string(os.PathSeparator)), nil
+}
+
+// returns [filename] relative to [destination] in the slash form, to name the entry in the errors
+func relativeEntryPath(destination string, filename string) string {
+	rel, err := filepath.Rel(destination, filename)
+	if err != nil {
+		return filepath.ToSlash(filename)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// checks whether the target [linkTarget] of the symlink [filename] stays beneath [destination]
+// the target is resolved against the files on the disk, following the symlinks on the way, as "d/../x" would escape
+// after a "d -> ." symlink even though it looks harmless on its own
+// ".." is only allowed at the start of the target, where it steps out of the parent directories of the link; elsewhere
+// it could step out of a symlink or a missing path element, which a later entry is free to replace with another symlink
+func isLinkTargetBeneath(destination string, filename string, linkTarget string) bool {
+	elements, err := pathElementsBeneath(destination, filepath.Dir(filename))
+	if err != nil {
+		return false
+	}
+
+	_, ok := resolveLinkTargetBeneath(destination, elements, linkTarget, 0)
+
+	return ok
+}
+
+// resolves [linkTarget] from the directory made of the path [elements] beneath [destination]
+// returns the path elements of the resolved target; false is returned if it escapes [destination]
+// [hops] is the number of the symlinks followed so far
+func resolveLinkTargetBeneath(destination string, elements []string, linkTarget string, hops int) ([]string, bool) {
+	if hops > maxSymlinkHops {
+		return nil, false
+	}
+
+	linkTarget = filepath.FromSlash(linkTarget)
+
+	if filepath.IsAbs(linkTarget) {
+		absDestination, err := filepath.Abs(destination)
+		if err != nil {
+			return nil, false
+		}
+
+		prefix := strings.TrimSuffix(absDestination, string(os.PathSeparator)) + string(os.PathSeparator)
+
+		if linkTarget != absDestination && !strings.HasPrefix(linkTarget, prefix) {
+			return nil, false
+		}
+
+		elements = nil
+		linkTarget = strings.TrimPrefix(strings.TrimPrefix(linkTarget, absDestination), string(os.PathSeparator))
+	}
+
+	resolved := append([]string{}, elements...)
+	descending := false
+
+	for _, element := range strings.Split(linkTarget, string(os.PathSeparator)) {
+		switch element {
+		case "", ".":
+			continue
+
+		case "..":
+			if descending || len(resolved) < 1 {
+				return nil, false
+			}
+
+			resolved = resolved[:len(resolved)-1]
+
+			continue
+		}
+
+		descending = true
+		resolved = append(resolved, element)
+
+		current := filepath.Join(destination, filepath.Join(resolved...))
+
+		fileInfo, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, false
+		}
+
+		if fileInfo.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		target, err := os.Readlink(current)
+		if err != nil {
+			return nil, false
+		}
+
+		var ok bool
+
+		resolved, ok = resolveLinkTargetBeneath(destination, resolved[:len(resolved)-1], target, hops+1)
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return resolved, true
+}
@@ -0,0 +1,218 @@
+//go:build linux
+// +build linux
+
+package onearchiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// the entries are written relative to the descriptors of their parent directories, which are opened one element at a time
+// without following any symlink; hence a symlink swapped in while unpacking can't redirect a write outside of the destination
+
+// creates the file [filename] beneath [destination]; an existing symlink at [filename] is replaced rather than written through
+func createFileBeneath(destination string, filename string, mode os.FileMode) (*os.File, error) {
+	dirFd, name, err := openParentBeneath(destination, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeFd(dirFd)
+
+	const flags = syscall.O_WRONLY | syscall.O_CREAT | syscall.O_TRUNC | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+
+	fd, err := syscall.Openat(dirFd, name, flags, uint32(mode.Perm()))
+	if err == syscall.ELOOP {
+		if err := syscall.Unlinkat(dirFd, name); err != nil {
+			return nil, &os.PathError{Op: "unlink", Path: filename, Err: err}
+		}
+
+		fd, err = syscall.Openat(dirFd, name, flags, uint32(mode.Perm()))
+	}
+
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: err}
+	}
+
+	return os.NewFile(uintptr(fd), filename), nil
+}
+
+// creates the directory [dirname] along with its parents beneath [destination]
+func mkdirAllBeneath(destination string, dirname string) error {
+	elements, err := pathElementsBeneath(destination, dirname)
+	if err != nil {
+		return err
+	}
+
+	dirFd, err := openDirBeneath(destination, elements, dirname)
+	if err != nil {
+		return err
+	}
+
+	closeFd(dirFd)
+
+	return nil
+}
+
+// creates the symlink [filename] -> [linkTarget] beneath [destination], replacing the existing file
+func symlinkBeneath(destination string, filename string, linkTarget string) error {
+	dirFd, name, err := openParentBeneath(destination, filename)
+	if err != nil {
+		return err
+	}
+
+	defer closeFd(dirFd)
+
+	if err := unlinkIfExists(dirFd, name, filename); err != nil {
+		return err
+	}
+
+	// [syscall] doesn't provide symlinkat
+	target, err := syscall.BytePtrFromString(linkTarget)
+	if err != nil {
+		return err
+	}
+
+	path, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_SYMLINKAT, uintptr(unsafe.Pointer(target)), uintptr(dirFd), uintptr(unsafe.Pointer(path)))
+	if errno != 0 {
+		return &os.PathError{Op: "symlink", Path: filename, Err: errno}
+	}
+
+	return nil
+}
+
+// creates the hard link [filename] to the existing file [targetFilename], both beneath [destination], replacing the existing file
+func linkBeneath(destination string, targetFilename string, filename string) error {
+	targetDirFd, targetName, err := openParentBeneath(destination, targetFilename)
+	if err != nil {
+		return err
+	}
+
+	defer closeFd(targetDirFd)
+
+	dirFd, name, err := openParentBeneath(destination, filename)
+	if err != nil {
+		return err
+	}
+
+	defer closeFd(dirFd)
+
+	if err := unlinkIfExists(dirFd, name, filename); err != nil {
+		return err
+	}
+
+	// [syscall] doesn't provide linkat
+	oldPath, err := syscall.BytePtrFromString(targetName)
+	if err != nil {
+		return err
+	}
+
+	newPath, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+
+	// the flags are left empty so that a symlinked [targetFilename] is linked to rather than followed
+	_, _, errno := syscall.Syscall6(syscall.SYS_LINKAT, uintptr(targetDirFd), uintptr(unsafe.Pointer(oldPath)),
+		uintptr(dirFd), uintptr(unsafe.Pointer(newPath)), 0, 0)
+	if errno != 0 {
+		return &os.LinkError{Op: "link", Old: targetFilename, New: filename, Err: errno}
+	}
+
+	return nil
+}
+
+// opens the parent directory of [filename] beneath [destination] and returns its descriptor along with the base name of [filename]
+func openParentBeneath(destination string, filename string) (int, string, error) {
+	elements, err := pathElementsBeneath(destination, filename)
+	if err != nil {
+		return -1, "", err
+	}
+
+	if len(elements) < 1 {
+		return -1, "", &os.PathError{Op: "open", Path: filename, Err: syscall.EISDIR}
+	}
+
+	dirFd, err := openDirBeneath(destination, elements[:len(elements)-1], filename)
+	if err != nil {
+		return -1, "", err
+	}
+
+	return dirFd, elements[len(elements)-1], nil
+}
+
+// opens the directory [elements] beneath [destination], creating the missing ones; [destination] itself may be a symlink
+// the returned descriptor is to be closed by the caller
+func openDirBeneath(destination string, elements []string, filename string) (int, error) {
+	if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+		return -1, err
+	}
+
+	dirFd, err := syscall.Open(destination, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: destination, Err: err}
+	}
+
+	for index, element := range elements {
+		fd, err := openSubdirAt(dirFd, element)
+		closeFd(dirFd)
+
+		dirname := filepath.Join(elements[:index+1]...)
+
+		// a symlink opened with O_NOFOLLOW and O_DIRECTORY fails with ENOTDIR
+		if err == syscall.ELOOP || err == syscall.ENOTDIR {
+			if fileInfo, err := os.Lstat(filepath.Join(destination, dirname)); err == nil && isSymlink(fileInfo) {
+				return -1, &UnsafePathError{
+					Entry:  relativeEntryPath(destination, filename),
+					Reason: fmt.Sprintf("symlink in the path: %s", filepath.ToSlash(dirname)),
+				}
+			}
+		}
+
+		if err != nil {
+			return -1, &os.PathError{Op: "open", Path: filepath.Join(destination, dirname), Err: err}
+		}
+
+		dirFd = fd
+	}
+
+	return dirFd, nil
+}
+
+func openSubdirAt(dirFd int, name string) (int, error) {
+	const flags = syscall.O_RDONLY | syscall.O_DIRECTORY | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+
+	fd, err := syscall.Openat(dirFd, name, flags, 0)
+	if err != syscall.ENOENT {
+		return fd, err
+	}
+
+	if err := syscall.Mkdirat(dirFd, name, uint32(os.ModePerm)); err != nil && err != syscall.EEXIST {
+		return -1, err
+	}
+
+	return syscall.Openat(dirFd, name, flags, 0)
+}
+
+func unlinkIfExists(dirFd int, name string, filename string) error {
+	if err := syscall.Unlinkat(dirFd, name); err != nil && err != syscall.ENOENT {
+		return &os.PathError{Op: "unlink", Path: filename, Err: err}
+	}
+
+	return nil
+}
+
+func closeFd(fd int) {
+	if err := syscall.Close(fd); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
@@ -0,0 +1,117 @@
+//go:build !linux
+// +build !linux
+
+package onearchiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// the parent directories of the entries are checked for symlinks before writing them,
+// but unlike linux the check isn't atomic with the write
+
+// creates the file [filename] beneath [destination]; an existing symlink at [filename] is replaced rather than written through
+func createFileBeneath(destination string, filename string, mode os.FileMode) (*os.File, error) {
+	if err := prepareParentBeneath(destination, filename); err != nil {
+		return nil, err
+	}
+
+	if fileInfo, err := os.Lstat(filename); err == nil && isSymlink(fileInfo) {
+		if err := os.Remove(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	return os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+}
+
+// creates the directory [dirname] along with its parents beneath [destination]
+func mkdirAllBeneath(destination string, dirname string) error {
+	if err := checkSymlinksBeneath(destination, dirname, true); err != nil {
+		return err
+	}
+
+	return os.MkdirAll(dirname, os.ModePerm)
+}
+
+// creates the symlink [filename] -> [linkTarget] beneath [destination], replacing the existing file
+func symlinkBeneath(destination string, filename string, linkTarget string) error {
+	if err := prepareParentBeneath(destination, filename); err != nil {
+		return err
+	}
+
+	if err := removeIfExists(filename); err != nil {
+		return err
+	}
+
+	return os.Symlink(linkTarget, filename)
+}
+
+// creates the hard link [filename] to the existing file [targetFilename], both beneath [destination], replacing the existing file
+func linkBeneath(destination string, targetFilename string, filename string) error {
+	if err := checkSymlinksBeneath(destination, targetFilename, false); err != nil {
+		return err
+	}
+
+	if err := prepareParentBeneath(destination, filename); err != nil {
+		return err
+	}
+
+	if err := removeIfExists(filename); err != nil {
+		return err
+	}
+
+	return os.Link(targetFilename, filename)
+}
+
+func prepareParentBeneath(destination string, filename string) error {
+	if err := checkSymlinksBeneath(destination, filename, false); err != nil {
+		return err
+	}
+
+	return os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+}
+
+// refuses the symlinks in the parent directories of [filename] beneath [destination]; [filename] itself is checked if [includeSelf] is set
+func checkSymlinksBeneath(destination string, filename string, includeSelf bool) error {
+	elements, err := pathElementsBeneath(destination, filename)
+	if err != nil {
+		return err
+	}
+
+	if !includeSelf && len(elements) > 0 {
+		elements = elements[:len(elements)-1]
+	}
+
+	for index := range elements {
+		dirname := filepath.Join(elements[:index+1]...)
+
+		fileInfo, err := os.Lstat(filepath.Join(destination, dirname))
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if isSymlink(fileInfo) {
+			return &UnsafePathError{
+				Entry:  relativeEntryPath(destination, filename),
+				Reason: fmt.Sprintf("symlink in the path: %s", filepath.ToSlash(dirname)),
+			}
+		}
+	}
+
+	return nil
+}
+
+func removeIfExists(filename string) error {
+	if _, err := os.Lstat(filename); err == nil {
+		return os.Remove(filename)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+package onearchiver
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// whence values of [os.File.Seek] which move to the next data region or hole of a file
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// returns the data regions of [file]; false if the file has no holes or the filesystem can't tell them apart
+func sparseDataRegions(file *os.File, fileInfo os.FileInfo) ([]sparseRegion, bool) {
+	size := fileInfo.Size()
+
+	// a file taking up as many blocks as its size has no holes
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok || size < 1 || stat.Blocks*512 >= size {
+		return nil, false
+	}
+
+	var regions []sparseRegion
+
+	offset := int64(0)
+	for offset < size {
+		dataOffset, err := file.Seek(offset, seekData)
+		if err != nil {
+			// no data past [offset], the rest of the file is a hole
+			if errors.Is(err, syscall.ENXIO) {
+				break
+			}
+
+			return nil, false
+		}
+
+		holeOffset, err := file.Seek(dataOffset, seekHole)
+		if err != nil {
+			return nil, false
+		}
+
+		regions = append(regions, sparseRegion{offset: dataOffset, length: holeOffset - dataOffset})
+		offset = holeOffset
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, false
+	}
+
+	return regions, true
+}
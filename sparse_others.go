@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package onearchiver
+
+import (
+	"os"
+)
+
+// the holes are only detected on linux; the sparse files are packed as regular files elsewhere
+func sparseDataRegions(file *os.File, fileInfo os.FileInfo) ([]sparseRegion, bool) {
+	return nil, false
+}
@@ -1,7 +1,10 @@
 package onearchiver
 
 import (
+	"archive/tar"
+	"context"
 	"github.com/yeka/zip"
+	"io"
 	"os"
 	"time"
 )
@@ -17,13 +20,25 @@ type ArchiveFileInfo struct {
 	FullPath   string
 	ParentPath string
 	Extension  string
+
+	// zip entries only
+	Comment string
 }
 
 type ArchiveMeta struct {
-	Filename         string
-	Password         string
+	Filename string
+
+	// zip files are encrypted entry by entry; the tarballs and the compressed files are wrapped in an age encrypted envelope
+	Password string
+
 	GitIgnorePattern []string
 	EncryptionMethod zip.EncryptionMethod
+
+	// tarballs and compressed files only; the envelope is encrypted for these age public keys (age1...) instead of [Password]
+	Recipients []string
+
+	// age secret keys (AGE-SECRET-KEY-1...) to open the envelopes encrypted for [Recipients]
+	Identities []string
 }
 
 type ArchiveRead struct {
@@ -31,15 +46,176 @@ type ArchiveRead struct {
 	OrderBy           ArchiveOrderBy
 	OrderDir          ArchiveOrderDir
 	Recursive         bool
+
+	// checked against the sizes in the headers; the compressed files are decompressed to find out their size, hence they are checked while streaming
+	// the encrypted zip entry which is decrypted to check the password is checked too
+	Limits ArchiveLimits
+}
+
+// limits against the decompression bombs; a zero field means no limit
+// the sizes in the headers are checked upfront and the actual bytes are checked while the entries are decompressed,
+// as the headers can't be trusted
+type ArchiveLimits struct {
+	// uncompressed bytes of all the entries put together
+	MaxTotalSize int64
+
+	// uncompressed bytes of a single entry
+	MaxEntrySize int64
+
+	MaxEntries int
+
+	// uncompressed bytes of all the entries put together over the size of the archive file
+	MaxCompressionRatio float64
 }
 
 type ArchivePack struct {
-	FileList []string
+	FileList    []string
+	Compression CompressionOptions
+
+	// what to do with the symlinks found while walking [FileList]; defaults to [SymlinkPolicySkip]
+	SymlinkPolicy SymlinkPolicy
+
+	// identical inputs give byte-identical archives; the mod times are set to [SourceDateEpoch],
+	// the ownership is dropped and the permissions are normalized to 0644/0755
+	// the encrypted zip files can't be reproduced as every encrypted entry is salted
+	Reproducible bool
+
+	// mod time of every entry in the [Reproducible] mode
+	// zero value falls back to the SOURCE_DATE_EPOCH environment variable and then to the unix epoch
+	SourceDateEpoch time.Time
+
+	// pack a file or a directory under an explicit path inside the archive, next to [FileList]
+	// an error is returned if a file ends up at the same path as a file of [FileList] or of another mapping
+	PathMappings []PathMapping
+
+	// path prepended to every entry inside the archive, e.g. "release-1.0/"
+	ArchivePrefix string
+
+	// split the archive into volumes of at most the given size in bytes; 0 writes a single file
+	// a zip file is written as a pkzip split set: [name].z01, [name].z02.. followed by [filename] as the last volume, which the other
+	// zip tools can open (e.g. zip -s 0 joins it); the other formats are split into plain byte-level volumes named [filename].001,
+	// [filename].002.., which are joined with e.g. cat
+	// the archive can be read back by [filename] or by any of its volumes
+	// the earlier copies of the archive are replaced: its volumes, and a regular file at [filename] even if it only shares the name
+	VolumeSize int64
+
+	// tarballs only; write the sub-second mod times, the access and the change times and the extended attributes
+	// (including the posix acls) as pax records; ignored in the [Reproducible] mode
+	PreserveMetadata bool
+
+	// tarballs only; the files sharing an inode are stored once, the other paths of the inode are written as hard links
+	// unpacking recreates the hard links either way
+	DetectHardLinks bool
+
+	// tarballs only; the holes of the sparse files are detected (linux only) and left out of the tarball,
+	// which is written with the gnu pax sparse headers. ignored if [Reproducible] is set
+	// unpacking leaves the holes of the sparse files unwritten either way
+	DetectSparseFiles bool
+
+	// zip only; comment of the zip file. updating an existing zip file keeps its comment if this is left empty
+	Comment string
+
+	// zip only; comments of the entries keyed by their path inside the archive
+	EntryComments map[string]string
+
+	// in-memory files to pack along with [FileList]
+	VirtualFiles []VirtualFile
+
+	// update the existing archive instead of recreating it; the new files are added, the changed files
+	// (by mod time or size) are replaced and the untouched entries are kept without recompressing them
+	// the compressed tarballs are rewritten as a stream; the encrypted zip files can't be updated
+	UpdateExisting bool
+
+	// zip only; store the already compressed files (jpeg, mp4, gz..) as is instead of deflating them again
+	// files with an unknown extension are probed by deflating their first few kilobytes
+	// encrypted entries are always deflated
+	SelectiveCompression bool
+
+	// zip only; number of the entries compressed concurrently, e.g. [runtime.NumCPU]; 0 or 1 compresses them one by one
+	// the encrypted zip files are always packed one by one
+	Workers int
+
+	// extensions (without the leading dot) which are always stored when [SelectiveCompression] is enabled
+	// nil falls back to [DefaultStoredExtensions]
+	StoredExtensions []string
+
+	// names of the ignore files (such as .gitignore and .archiveignore) which are looked for in every walked directory
+	// the patterns of an ignore file apply to its own directory tree, along with [ArchiveMeta.GitIgnorePattern]; nil disables it
+	IgnoreFileNames []string
+
+	// the files are packed only if their size falls within [MinSize] and [MaxSize] (both inclusive); 0 disables either bound
+	// the size and the mod time filters don't apply to the directories, so that the directories of the matching files are kept
+	MinSize int64
+	MaxSize int64
+
+	// the files are packed only if they were modified at or after [ModifiedAfter] and before [ModifiedBefore]; zero disables either bound
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// the files are packed only if they are one of these types; nil packs every type
+	FileTypes []FileType
+
+	// return false to leave a file out; it is called after the other filters with the path of the file inside the archive,
+	// [ArchivePrefix] included
+	// none of the filters apply to [VirtualFiles]
+	FilterFunc func(relativeFilePath string, fileInfo os.FileInfo) bool
+
+	// zip only; overrides the compression method ([zip.Store] or [zip.Deflate]) of an entry
+	// return false to fall back to the default selection; not supported for the encrypted zip files, as they are always deflated
+	CompressionMethodFunc func(relativeFilePath string, fileInfo os.FileInfo) (method uint16, ok bool)
+}
+
+type CompressionOptions struct {
+	// compression level for every codec which supports it; 0 uses [DefaultCompressionLevel]
+	Level int
+
+	// brotli quality (0-11); 0 falls back to [Level]
+	BrotliQuality int
+
+	// zstd window size in bytes, must be a power of 2; 0 uses the encoder default
+	ZstdWindowSize int
+
+	// xz dictionary capacity in bytes; 0 uses the xz default (8 MiB)
+	XzDictCap int
+}
+
+type PathMapping struct {
+	// file or directory on the disk
+	Source string
+
+	// path of [Source] inside the archive; the contents of a directory can be put at the root of the archive using ""
+	ArchivePath string
+}
+
+type VirtualFile struct {
+	// path inside the archive; a trailing slash makes it a directory
+	Name string
+
+	// contents of the file; either [Reader] or [Bytes]
+	Reader io.Reader
+	Bytes  []byte
+
+	// size of [Reader]; tarballs need it upfront, if it is 0 the reader is buffered in the memory
+	Size int64
+
+	// defaults to 0644 (0755 for the directories)
+	Mode os.FileMode
+
+	// defaults to the current time
+	ModTime time.Time
 }
 
 type ArchiveUnpack struct {
 	FileList    []string
 	Destination string
+
+	// tarballs only; restore the ownership, the mod and access times and the extended attributes of the entries
+	// whatever the current user isn't allowed to restore (e.g. the ownership as a regular user) is skipped
+	PreserveMetadata bool
+
+	// the files unpacked so far are removed once a limit is exceeded
+	// the encrypted zip entry which is decrypted to check the password is checked too
+	Limits ArchiveLimits
 }
 
 type filePathListSortInfo struct {
@@ -59,6 +235,10 @@ type zipArchive struct {
 	read   ArchiveRead   // required for listing files
 	pack   ArchivePack   // required for archiving files
 	unpack ArchiveUnpack // required for unarchiving files
+
+	ctx      context.Context // checked between the entries and while copying them; can be nil
+	unpacked *unpackedPaths  // the paths created while unarchiving files; can be nil
+	source   *archiveSource  // the archive being read; required for listing and unarchiving files
 }
 
 type commonArchive struct {
@@ -66,6 +246,10 @@ type commonArchive struct {
 	read   ArchiveRead   // required for listing files
 	pack   ArchivePack   // required for archiving files
 	unpack ArchiveUnpack // required for unarchiving files
+
+	ctx      context.Context // checked between the entries and while copying them; can be nil
+	unpacked *unpackedPaths  // the paths created while unarchiving files; can be nil
+	source   *archiveSource  // the archive being read; required for listing and unarchiving files
 }
 
 type ArchiveReader interface {
@@ -88,6 +272,8 @@ type createArchiveFileInfo struct {
 	absFilepath, relativeFilePath string
 	isDir                         bool
 	fileInfo                      *os.FileInfo
+	linkTarget                    string       // set if the file is stored as a symlink
+	virtualFile                   *VirtualFile // set if the file is an in-memory file
 }
 
 type extractZipFileInfo struct {
@@ -99,7 +285,67 @@ type extractZipFileInfo struct {
 type extractCommonArchiveFileInfo struct {
 	absFilepath, name string
 	fileInfo          *ArchiveFileInfo
-	fileBytes         *[]byte
+	linkTarget        string      // set if the file is a symlink
+	hardLinkTarget    string      // set if the file is a hard link; path inside the archive
+	tarHeader         *tar.Header // set if the file comes from a tarball
+}
+
+// what [StartPacking] would write, as returned by [PlanPacking]
+type PackPlan struct {
+	Entries []PackPlanEntry
+	Skipped []SkippedFile
+
+	// sum of the sizes of [Entries]
+	TotalSize int64
+}
+
+type PackPlanEntry struct {
+	// empty for the [ArchivePack.VirtualFiles] and the parent directories added for the archive paths
+	SourcePath string
+
+	// path inside the archive; the directories end with a slash
+	ArchivePath string
+
+	Size       int64
+	IsDir      bool
+	LinkTarget string
+}
+
+// a file which is left out of packing or unpacking
+type SkippedFile struct {
+	// path on the disk while packing, path inside the archive while unpacking
+	Path string
+
+	// the ignore pattern, the ignore file rule ("file:line:pattern") or the filter which left the file out
+	Reason string
+}
+
+// what [StartUnpacking] would write, as returned by [PlanUnpacking]
+type UnpackPlan struct {
+	Entries []UnpackPlanEntry
+	Skipped []SkippedFile
+
+	// sum of the sizes of [Entries]
+	TotalSize int64
+}
+
+type UnpackPlanEntry struct {
+	ArchivePath     string
+	DestinationPath string
+	Size            int64
+	IsDir           bool
+
+	// a file already exists at [DestinationPath] and would be overwritten
+	Overwrite bool
+
+	// why the entry can't be unpacked as is; e.g. a directory is in the way of a file or two entries share the destination
+	Conflict string
+}
+
+// archive level details which aren't part of [GetArchiveFileList]
+type ArchiveMetadata struct {
+	// comment of the zip file
+	Comment string
 }
 
 type EncryptedArchiveInfo struct {
@@ -113,6 +359,24 @@ type ProgressInfo struct {
 	ProgressCount      int
 	CurrentFilename    string
 	ProgressPercentage float32
+
+	// sizes of the files to process; the directories and the links take up no bytes
+	// unpacking a single compressed file, a tarball or a rar archive counts the bytes read from the archive,
+	// as the uncompressed size isn't known upfront; [TotalFiles] is the number of the entries found so far for the latter two
+	TotalBytes     int64
+	ProcessedBytes int64
+
+	// size of [CurrentFilename] and the bytes of it processed so far
+	CurrentFileSize           int64
+	CurrentFileProcessedBytes int64
+
+	// average throughput since [StartTime]; the remaining time is estimated from it and is 0 until any bytes are processed
+	BytesPerSecond         float64
+	EstimatedTimeRemaining time.Duration
+
+	// bytes of the files which are done with
+	completedBytes int64
+	lastReportTime time.Time
 }
 
 type ProgressHandler struct {
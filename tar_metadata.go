@@ -0,0 +1,91 @@
+package onearchiver
+
+import (
+	"archive/tar"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adds the metadata which the default tar header leaves out; the header is switched to the pax format,
+// which keeps the sub-second mod times, the access and the change times and the extended attributes
+// the ownership (uid, gid, user and group names) is filled in by [tar.FileInfoHeader] already
+func addTarMetadata(header *tar.Header, item *createArchiveFileInfo) error {
+	header.Format = tar.FormatPAX
+
+	// the in-memory files and the symlinks carry no extended attributes
+	if item.virtualFile != nil || item.linkTarget != "" {
+		return nil
+	}
+
+	xattrs, err := readXattrs(item.absFilepath)
+	if err != nil {
+		return err
+	}
+
+	if len(xattrs) < 1 {
+		return nil
+	}
+
+	if header.PAXRecords == nil {
+		header.PAXRecords = make(map[string]string)
+	}
+
+	for name, value := range xattrs {
+		header.PAXRecords[paxXattrPrefix+name] = value
+	}
+
+	return nil
+}
+
+// restores the ownership, the mod and access times and the extended attributes of [filename] from [header]
+// none of them follows the symlinks, as a hard link entry may link to a symlink too
+// whatever the current user isn't allowed to restore is skipped
+func restoreTarMetadata(filename string, header *tar.Header) error {
+	if err := lchownFile(filename, tarHeaderUid(header), tarHeaderGid(header)); err != nil {
+		return err
+	}
+
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+
+		if err := writeXattr(filename, strings.TrimPrefix(key, paxXattrPrefix), value); err != nil {
+			return err
+		}
+	}
+
+	accessTime := header.AccessTime
+	if accessTime.IsZero() {
+		accessTime = time.Now()
+	}
+
+	return lchtimesFile(filename, accessTime, header.ModTime)
+}
+
+// the user name takes precedence over the uid as the ids differ between the machines; same as gnu tar
+func tarHeaderUid(header *tar.Header) int {
+	if header.Uname != "" {
+		if u, err := user.Lookup(header.Uname); err == nil {
+			if uid, err := strconv.Atoi(u.Uid); err == nil {
+				return uid
+			}
+		}
+	}
+
+	return header.Uid
+}
+
+func tarHeaderGid(header *tar.Header) int {
+	if header.Gname != "" {
+		if g, err := user.LookupGroup(header.Gname); err == nil {
+			if gid, err := strconv.Atoi(g.Gid); err == nil {
+				return gid
+			}
+		}
+	}
+
+	return header.Gid
+}
@@ -137,4 +137,47 @@ func TestUtils(t *testing.T) {
 			So(p, ShouldEqual, f.parentPath)
 		}
 	})
+
+	Convey("Test path within", t, func() {
+		type s struct {
+			parent, path string
+			within       bool
+		}
+
+		sl := []s{
+			s{
+				parent: "/dest",
+				path:   "/dest/a.txt",
+				within: true,
+			}, s{
+				parent: "/dest",
+				path:   "/dest",
+				within: true,
+			}, s{
+				parent: "/dest/",
+				path:   "/dest/1/../a.txt",
+				within: true,
+			}, s{
+				parent: "/dest",
+				path:   "/dest/../a.txt",
+				within: false,
+			}, s{
+				parent: "/dest",
+				path:   "/destination/a.txt",
+				within: false,
+			}, s{
+				parent: "/dest",
+				path:   "/etc/passwd",
+				within: false,
+			}, s{
+				parent: "dest",
+				path:   "dest/..a.txt",
+				within: true,
+			},
+		}
+
+		for _, f := range sl {
+			So(isPathWithin(f.parent, f.path), ShouldEqual, f.within)
+		}
+	})
 }
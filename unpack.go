@@ -1,6 +1,7 @@
 package onearchiver
 
 import (
+	"context"
 	"fmt"
 	"github.com/ganeshrvel/archiver"
 	"path/filepath"
@@ -26,45 +27,115 @@ func (arc commonArchive) doUnpack(ph *ProgressHandler) error {
 		return err
 	}
 
-	var arcWalker, ok = arcFileObj.(archiver.Walker)
+	if isCompressedFileFormat(arcFileObj) {
+		return unpackCompressedFile(&arc, arcFileObj, ph)
+	}
+
+	var arcReader, ok = arcFileObj.(archiver.Reader)
 	if !ok {
 		return fmt.Errorf("some error occured while reading the archive")
 	}
 
-	return startUnpackingCommonArchives(arc, arcWalker, ph)
+	return startUnpackingCommonArchives(arc, arcReader, ph)
 }
 
 func StartUnpacking(meta *ArchiveMeta, pack *ArchiveUnpack, ph *ProgressHandler) error {
-	_meta := *meta
+	return StartUnpackingContext(context.Background(), meta, pack, ph)
+}
+
+// [StartUnpacking] which stops once [ctx] is done and returns [ErrCancelled]
+// the files and the directories created so far are removed, as they are on any other error (e.g. once any of [ArchiveUnpack.Limits]
+// is exceeded or an unsafe entry turns up); the files which existed already are left as they are
+func StartUnpackingContext(ctx context.Context, meta *ArchiveMeta, pack *ArchiveUnpack, ph *ProgressHandler) error {
 	_pack := *pack
+	_meta := *meta
 
-	var arcUnpackObj ArchiveUnpacker
+	source, err := openArchiveSource(&_meta)
+	if err != nil {
+		return err
+	}
 
-	// check whether the archive is encrypted
-	// if yes, check whether the password is valid
-	iae, err := IsArchiveEncrypted(meta)
+	defer source.close()
+
+	var arcUnpackObj ArchiveUnpacker
 
+	// the envelope is decrypted as the archive is read; its password is checked while opening it
+	isEnvelope, err := openArchiveEnvelope(ctx, &_meta, source)
 	if err != nil {
 		return err
 	}
 
-	if iae.IsEncrypted && !iae.IsValidPassword {
-		return fmt.Errorf("invalid password")
+	if !isEnvelope {
+		// check whether the archive is encrypted
+		// if yes, check whether the password is valid
+		iae, err := isArchiveEncrypted(ctx, &_meta, source, _pack.Limits)
+
+		if err != nil {
+			return err
+		}
+
+		if iae.IsEncrypted && !iae.IsValidPassword {
+			return fmt.Errorf("invalid password")
+		}
 	}
 
 	ext := filepath.Ext(_meta.Filename)
 
+	unpacked := newUnpackedPaths(_pack.Destination)
+
 	switch ext {
 	case ".zip":
-		arcUnpackObj = zipArchive{meta: _meta, unpack: _pack}
+		arcUnpackObj = zipArchive{meta: _meta, unpack: _pack, ctx: ctx, unpacked: unpacked, source: source}
 
 		break
 
 	default:
-		arcUnpackObj = commonArchive{meta: _meta, unpack: _pack}
+		arcUnpackObj = commonArchive{meta: _meta, unpack: _pack, ctx: ctx, unpacked: unpacked, source: source}
 
 		break
 	}
 
-	return arcUnpackObj.doUnpack(ph)
+	err = arcUnpackObj.doUnpack(ph)
+	if err != nil {
+		unpacked.remove()
+	}
+
+	return err
+}
+
+// recreates the symlink [filename] -> [linkTarget]
+// refuses the link targets which would escape the [destination] directory
+func addSymlinkToDisk(destination string, filename string, linkTarget string) error {
+	linkTarget = filepath.FromSlash(linkTarget)
+
+	if !isLinkTargetBeneath(destination, filename, linkTarget) {
+		return &UnsafePathError{
+			Entry:  relativeEntryPath(destination, filename),
+			Reason: fmt.Sprintf("symlink target escapes the destination: %s", linkTarget),
+		}
+	}
+
+	// overwrites the existing file
+	return symlinkBeneath(destination, filename, linkTarget)
+}
+
+// recreates the hard link [filename] to the entry [linkTarget] of the archive, which has to be written by this run already;
+// see [unpackDetachedHardLinks] for the others
+// refuses the link targets which would escape the [destination] directory
+func addHardLinkToDisk(destination string, filename string, linkTarget string) error {
+	resolvedLinkTarget := filepath.Join(destination, filepath.FromSlash(linkTarget))
+
+	if !isPathWithin(destination, resolvedLinkTarget) {
+		return &UnsafePathError{
+			Entry:  relativeEntryPath(destination, filename),
+			Reason: fmt.Sprintf("hard link target escapes the destination: %s", linkTarget),
+		}
+	}
+
+	if !exists(resolvedLinkTarget) {
+		return fmt.Errorf("hard link target was not unpacked: %s -> %s", filename, linkTarget)
+	}
+
+	// overwrites the existing file
+	return linkBeneath(destination, resolvedLinkTarget, filename)
 }
@@ -2,6 +2,8 @@ package onearchiver
 
 import (
 	"archive/tar"
+	"context"
+	"fmt"
 	"github.com/ganeshrvel/archiver"
 	"github.com/nwaples/rardecode"
 	ignore "github.com/sabhiram/go-gitignore"
@@ -11,8 +13,11 @@ import (
 	"path/filepath"
 )
 
-func startUnpackingCommonArchives(arc commonArchive, arcWalker interface{ archiver.Walker }, ph *ProgressHandler) error {
-	_filename := arc.meta.Filename
+// the entries are written to disk while walking the archive, so that the memory use doesn't grow with the size of the entries
+// the archive is walked once; every entry is checked against [ArchiveUnpack.Limits] and the destination right before it is written,
+// and the caller removes what was written so far on an error
+// the entries aren't known upfront, hence the progress follows the bytes read from the archive
+func startUnpackingCommonArchives(arc commonArchive, arcReader archiver.Reader, ph *ProgressHandler) error {
 	_gitIgnorePattern := arc.meta.GitIgnorePattern
 	_fileList := arc.unpack.FileList
 	_destination := arc.unpack.Destination
@@ -25,56 +30,26 @@ func startUnpackingCommonArchives(arc commonArchive, arcWalker interface{ archiv
 
 	ignoreMatches := ignore.CompileIgnoreLines(ignoreList...)
 
-	commonArchiveFilePathListMap := make(map[string]extractCommonArchiveFileInfo)
+	limits := newLimitTracker(arc.unpack.Limits, arc.source.size)
 
-	err := arcWalker.Walk(_filename, func(file archiver.File) error {
-		var fileInfo ArchiveFileInfo
+	pInfo, ch := initProgress(0, arc.source.size, ph)
+	onRead := pInfo.archiveByteCounter(ch)
 
-		switch fileHeader := file.Header.(type) {
-		case *tar.Header:
-			fullPath := filepath.ToSlash(fileHeader.Name)
-			isDir := file.IsDir()
+	var hardLinks []*extractCommonArchiveFileInfo
+	tarHeaders := make(map[string]*tar.Header)
 
-			fileInfo = ArchiveFileInfo{
-				Mode:       file.Mode(),
-				Size:       file.Size(),
-				IsDir:      isDir,
-				ModTime:    file.ModTime(),
-				Name:       file.Name(),
-				FullPath:   fullPath,
-				ParentPath: GetParentDirectory(fullPath),
-			}
-
-		case *rardecode.FileHeader:
-			isDir := file.IsDir()
-			fullPath := fixDirSlash(isDir, filepath.ToSlash(file.Name()))
-
-			fileInfo = ArchiveFileInfo{
-				Mode:       file.Mode(),
-				Size:       file.Size(),
-				IsDir:      isDir,
-				ModTime:    file.ModTime(),
-				Name:       filepath.Base(fullPath),
-				FullPath:   fullPath,
-				ParentPath: GetParentDirectory(fullPath),
-			}
+	// the files written by this run; a hard link is only made to a file of the archive, not to a file which was at its path already
+	written := make(map[string]bool)
 
-		// not currently being used
-		default:
-			fullPath := filepath.ToSlash(file.FileInfo.Name())
-			isDir := file.IsDir()
-
-			fileInfo = ArchiveFileInfo{
-				Mode:       file.Mode(),
-				Size:       file.Size(),
-				IsDir:      isDir,
-				ModTime:    file.ModTime(),
-				Name:       file.Name(),
-				FullPath:   fullPath,
-				ParentPath: GetParentDirectory(fullPath),
-			}
+	count := 0
+	err := walkArchive(arcReader, newProgressReader(arc.source.reader(), onRead), func(file archiver.File) error {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
 		}
 
+		entry := commonArchiveEntry(file)
+		fileInfo := entry.fileInfo
+
 		if allowFileFiltering {
 			matched := StringFilter(_fileList, func(s string) bool {
 				_fName := fixDirSlash(fileInfo.IsDir, fileInfo.FullPath)
@@ -91,38 +66,92 @@ func startUnpackingCommonArchives(arc commonArchive, arcWalker interface{ archiv
 			return nil
 		}
 
-		_absPath := filepath.Join(_destination, fileInfo.FullPath)
+		_absPath, err := entryDestinationPath(_destination, fileInfo.FullPath)
+		if err != nil {
+			return err
+		}
 
-		fileData := make([]byte, file.Size())
-		numBytesRead, err := file.Read(fileData)
-		if err != nil && !(numBytesRead == int(file.Size()) && err == io.EOF) {
+		entry.absFilepath = _absPath
+
+		if err := limits.addEntry(fileInfo.FullPath, file.Size()); err != nil {
 			return err
 		}
 
-		commonArchiveFilePathListMap[_absPath] = extractCommonArchiveFileInfo{
-			absFilepath: _absPath,
-			name:        fileInfo.Name,
-			fileInfo:    &fileInfo,
-			fileBytes:   &fileData,
+		if arc.unpack.PreserveMetadata && entry.tarHeader != nil {
+			tarHeaders[entry.absFilepath] = entry.tarHeader
+		}
+
+		// the hard links are created once the files they link to are written
+		if entry.hardLinkTarget != "" {
+			hardLinks = append(hardLinks, entry)
+
+			return nil
 		}
 
+		count += 1
+		pInfo.archiveProgress(ch, entry.absFilepath, count)
+
+		arc.unpacked.track(entry.absFilepath)
+
+		if err := addFileFromCommonArchiveToDisk(arc.ctx, entry, file, _destination, limits); err != nil {
+			return err
+		}
+
+		written[entry.absFilepath] = true
+
 		return nil
 	})
 
-	totalFiles := len(commonArchiveFilePathListMap)
-	pInfo, ch := initProgress(totalFiles, ph)
+	if err != nil {
+		return err
+	}
+
+	// the hard links to the files which weren't written, grouped by their targets
+	detachedLinks := make(map[string][]*extractCommonArchiveFileInfo)
+
+	for _, entry := range hardLinks {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
+		// the targets escaping the destination are refused by [addHardLinkToDisk]
+		linkTarget := filepath.Join(_destination, filepath.FromSlash(entry.hardLinkTarget))
+		if !written[linkTarget] && isPathWithin(_destination, linkTarget) {
+			detachedLinks[linkTarget] = append(detachedLinks[linkTarget], entry)
+
+			continue
+		}
 
-	count := 0
-	for absolutePath, file := range commonArchiveFilePathListMap {
 		count += 1
-		pInfo.progress(ch, totalFiles, absolutePath, count)
+		pInfo.archiveProgress(ch, entry.absFilepath, count)
+
+		arc.unpacked.track(entry.absFilepath)
+
+		if err := addHardLinkToDisk(_destination, entry.absFilepath, entry.hardLinkTarget); err != nil {
+			return err
+		}
 
-		if err := addFileFromCommonArchiveToDisk(&file, absolutePath); err != nil {
+		written[entry.absFilepath] = true
+	}
+
+	if len(detachedLinks) > 0 {
+		if err := unpackDetachedHardLinks(arc, arcReader, detachedLinks, limits); err != nil {
 			return err
 		}
+
+		for _, entries := range detachedLinks {
+			count += len(entries)
+		}
 	}
 
-	pInfo.endProgress(ch, totalFiles)
+	// restored once all the files are written, as writing a file would change the mod time of its directory
+	for absolutePath, tarHeader := range tarHeaders {
+		if err := restoreTarMetadata(absolutePath, tarHeader); err != nil {
+			return err
+		}
+	}
+
+	pInfo.endProgress(ch, count)
 
 	if !exists(_destination) {
 		if err := os.Mkdir(_destination, 0755); err != nil {
@@ -130,23 +159,180 @@ func startUnpackingCommonArchives(arc commonArchive, arcWalker interface{ archiv
 		}
 	}
 
-	return err
+	return nil
 }
 
-func addFileFromCommonArchiveToDisk(file *extractCommonArchiveFileInfo, filename string) error {
-	if file.fileInfo.IsDir {
-		if err := os.MkdirAll(filename, os.ModePerm); err != nil {
+// unpacks the hard links whose targets weren't written (e.g. the targets left out by [ArchiveUnpack.FileList] or an ignore pattern)
+// the archive is walked again: the data of the target entry is written into the first link of [detachedLinks], and the other links
+// to the same target are linked to it
+func unpackDetachedHardLinks(arc commonArchive, arcReader archiver.Reader, detachedLinks map[string][]*extractCommonArchiveFileInfo, limits *limitTracker) error {
+	_destination := arc.unpack.Destination
+
+	if err := arc.source.rewind(arc.ctx, &arc.meta); err != nil {
+		return err
+	}
+
+	found := make(map[string]bool)
+
+	err := walkArchive(arcReader, arc.source.reader(), func(file archiver.File) error {
+		if err := checkContext(arc.ctx); err != nil {
 			return err
 		}
 
-		return nil
-	} else {
-		_basename := filepath.Dir(filename)
+		target := commonArchiveEntry(file)
+
+		// only the entries holding the data of a file can be linked to
+		if target.fileInfo.IsDir || target.linkTarget != "" || target.hardLinkTarget != "" {
+			return nil
+		}
+
+		_absPath, err := entryDestinationPath(_destination, target.fileInfo.FullPath)
+		if err != nil {
+			return err
+		}
+
+		entries, ok := detachedLinks[_absPath]
+		if !ok || found[_absPath] {
+			return nil
+		}
+
+		found[_absPath] = true
+
+		first := *target
+		first.absFilepath = entries[0].absFilepath
+		first.fileInfo = &ArchiveFileInfo{Mode: target.fileInfo.Mode, FullPath: entries[0].fileInfo.FullPath}
 
-		if err := os.MkdirAll(_basename, os.ModePerm); err != nil {
+		arc.unpacked.track(first.absFilepath)
+
+		if err := addFileFromCommonArchiveToDisk(arc.ctx, &first, file, _destination, limits); err != nil {
 			return err
 		}
+
+		for _, entry := range entries[1:] {
+			arc.unpacked.track(entry.absFilepath)
+
+			if err := linkBeneath(_destination, first.absFilepath, entry.absFilepath); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for linkTarget, entries := range detachedLinks {
+		if !found[linkTarget] {
+			return fmt.Errorf("hard link target is missing from the archive: %s -> %s", entries[0].fileInfo.FullPath, entries[0].hardLinkTarget)
+		}
+	}
+
+	return nil
+}
+
+// reads the header of the entry [file]; [extractCommonArchiveFileInfo.absFilepath] is left empty
+func commonArchiveEntry(file archiver.File) *extractCommonArchiveFileInfo {
+	var fileInfo ArchiveFileInfo
+	var tarHeader *tar.Header
+	linkTarget := ""
+	hardLinkTarget := ""
+
+	switch fileHeader := file.Header.(type) {
+	case *tar.Header:
+		fullPath := filepath.ToSlash(fileHeader.Name)
+		isDir := file.IsDir()
+		tarHeader = fileHeader
+
+		if fileHeader.Typeflag == tar.TypeSymlink {
+			linkTarget = fileHeader.Linkname
+		}
+
+		if fileHeader.Typeflag == tar.TypeLink {
+			hardLinkTarget = filepath.ToSlash(fileHeader.Linkname)
+		}
+
+		fileInfo = ArchiveFileInfo{
+			Mode:       file.Mode(),
+			Size:       file.Size(),
+			IsDir:      isDir,
+			ModTime:    file.ModTime(),
+			Name:       file.Name(),
+			FullPath:   fullPath,
+			ParentPath: GetParentDirectory(fullPath),
+		}
+
+	case *rardecode.FileHeader:
+		isDir := file.IsDir()
+		fullPath := fixDirSlash(isDir, filepath.ToSlash(file.Name()))
+
+		fileInfo = ArchiveFileInfo{
+			Mode:       file.Mode(),
+			Size:       file.Size(),
+			IsDir:      isDir,
+			ModTime:    file.ModTime(),
+			Name:       filepath.Base(fullPath),
+			FullPath:   fullPath,
+			ParentPath: GetParentDirectory(fullPath),
+		}
+
+	// not currently being used
+	default:
+		fullPath := filepath.ToSlash(file.FileInfo.Name())
+		isDir := file.IsDir()
+
+		fileInfo = ArchiveFileInfo{
+			Mode:       file.Mode(),
+			Size:       file.Size(),
+			IsDir:      isDir,
+			ModTime:    file.ModTime(),
+			Name:       file.Name(),
+			FullPath:   fullPath,
+			ParentPath: GetParentDirectory(fullPath),
+		}
+	}
+
+	return &extractCommonArchiveFileInfo{
+		name:           fileInfo.Name,
+		fileInfo:       &fileInfo,
+		linkTarget:     linkTarget,
+		hardLinkTarget: hardLinkTarget,
+		tarHeader:      tarHeader,
+	}
+}
+
+// copies the content of the entry from [r] straight into the file
+func addFileFromCommonArchiveToDisk(ctx context.Context, file *extractCommonArchiveFileInfo, r io.Reader, destination string, limits *limitTracker) error {
+	filename := file.absFilepath
+
+	if file.linkTarget != "" {
+		return addSymlinkToDisk(destination, filename, file.linkTarget)
+	}
+
+	if file.fileInfo.IsDir {
+		return mkdirAllBeneath(destination, filename)
+	}
+
+	out, err := createFileBeneath(destination, filename, file.fileInfo.Mode)
+	if err != nil {
+		return err
+	}
+
+	in := newContextReader(ctx, r)
+
+	// the size in the header isn't trusted, the bytes are counted as they are copied
+	if file.tarHeader != nil && isSparseTarHeader(file.tarHeader) {
+		_, err = writeSparseFile(out, io.TeeReader(in, limits.writer(file.fileInfo.FullPath, ioutil.Discard)))
+	} else {
+		_, err = io.Copy(limits.writer(file.fileInfo.FullPath, out), in)
+	}
+
+	if err != nil {
+		_ = out.Close()
+
+		return err
 	}
 
-	return ioutil.WriteFile(file.absFilepath, *file.fileBytes, file.fileInfo.Mode)
+	return out.Close()
 }
@@ -1,16 +1,17 @@
 package onearchiver
 
 import (
+	"context"
 	"fmt"
 	ignore "github.com/sabhiram/go-gitignore"
 	"github.com/yeka/zip"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 )
 
 func startUnpackingZip(arc zipArchive, ph *ProgressHandler) error {
-	_filename := arc.meta.Filename
 	_password := arc.meta.Password
 	_destination := arc.unpack.Destination
 	_gitIgnorePattern := arc.meta.GitIgnorePattern
@@ -18,18 +19,21 @@ func startUnpackingZip(arc zipArchive, ph *ProgressHandler) error {
 
 	allowFileFiltering := len(_fileList) > 0
 
-	reader, err := zip.OpenReader(_filename)
+	reader, err := zip.NewReader(arc.source, arc.source.size)
 	if err != nil {
 		return err
 	}
 
+	limits := newLimitTracker(arc.unpack.Limits, arc.source.size)
+
 	var ignoreList []string
 	ignoreList = append(ignoreList, GlobalPatternDenylist...)
 	ignoreList = append(ignoreList, _gitIgnorePattern...)
 
 	ignoreMatches := ignore.CompileIgnoreLines(ignoreList...)
 
-	zipFilePathListMap := make(map[string]extractZipFileInfo)
+	// in the order of the archive
+	var zipFileList []extractZipFileInfo
 
 	for _, file := range reader.File {
 		if file.IsEncrypted() {
@@ -55,37 +59,62 @@ func startUnpackingZip(arc zipArchive, ph *ProgressHandler) error {
 			continue
 		}
 
-		_absPath := filepath.Join(_destination, fileName)
+		_absPath, err := entryDestinationPath(_destination, file.Name)
+		if err != nil {
+			return err
+		}
+
+		// checked against the headers before anything is written
+		if err := limits.addEntry(file.Name, int64(file.UncompressedSize64)); err != nil {
+			return err
+		}
 
-		zipFilePathListMap[_absPath] = extractZipFileInfo{
+		zipFileList = append(zipFileList, extractZipFileInfo{
 			absFilepath: _absPath,
 			name:        fileName,
 			fileInfo:    &_fileInfo,
 			zipFileInfo: file,
-		}
+		})
+	}
+
+	totalBytes := int64(0)
+	for _, file := range zipFileList {
+		totalBytes += unpackingFileSize(*file.fileInfo)
 	}
 
 	totalFiles := len(reader.File)
-	pInfo, ch := initProgress(totalFiles, ph)
+	pInfo, ch := initProgress(totalFiles, totalBytes, ph)
+
+	onRead := pInfo.byteCounter(ch)
+
+	// the symlinks are created once the other entries are written, so that no entry is written through a symlink of the archive
+	var regularFiles, symlinks []extractZipFileInfo
+	for _, file := range zipFileList {
+		if isSymlink(*file.fileInfo) {
+			symlinks = append(symlinks, file)
+		} else {
+			regularFiles = append(regularFiles, file)
+		}
+	}
 
 	count := 0
-	for absolutePath, file := range zipFilePathListMap {
+	for _, file := range append(regularFiles, symlinks...) {
+		if err := checkContext(arc.ctx); err != nil {
+			return err
+		}
+
 		count += 1
-		pInfo.progress(ch, totalFiles, absolutePath, count)
+		pInfo.progress(ch, totalFiles, file.absFilepath, count, unpackingFileSize(*file.fileInfo))
 
-		if err := addFileFromZipToDisk(file.zipFileInfo, absolutePath); err != nil {
+		arc.unpacked.track(file.absFilepath)
+
+		if err := addFileFromZipToDisk(arc.ctx, file.zipFileInfo, file.absFilepath, _destination, limits, onRead); err != nil {
 			return err
 		}
 	}
 
 	pInfo.endProgress(ch, totalFiles)
 
-	defer func() {
-		if err := reader.Close(); err != nil {
-			fmt.Printf("%v\n", err)
-		}
-	}()
-
 	if !exists(_destination) {
 		if err := os.Mkdir(_destination, 0755); err != nil {
 			return err
@@ -95,7 +124,9 @@ func startUnpackingZip(arc zipArchive, ph *ProgressHandler) error {
 	return nil
 }
 
-func addFileFromZipToDisk(file *zip.File, filename string) error {
+// [limits] counts the bytes of the file as they are unpacked, as the size in the header may lie
+// [onRead] reports the bytes of the file as they are unpacked; can be nil
+func addFileFromZipToDisk(ctx context.Context, file *zip.File, filename string, destination string, limits *limitTracker, onRead func(int)) error {
 	fileToExtract, err := file.Open()
 
 	if err != nil {
@@ -108,26 +139,32 @@ func addFileFromZipToDisk(file *zip.File, filename string) error {
 		}
 	}()
 
-	if file.FileInfo().IsDir() {
-		if err := os.MkdirAll(filename, os.ModePerm); err != nil {
+	// the symlink target is stored as the contents of the entry
+	if isSymlink(file.FileInfo()) {
+		linkTarget, err := ioutil.ReadAll(fileToExtract)
+		if err != nil {
 			return err
 		}
 
-		return nil
-	} else {
-		_basename := filepath.Dir(filename)
+		return addSymlinkToDisk(destination, filename, string(linkTarget))
+	}
 
-		if err := os.MkdirAll(_basename, os.ModePerm); err != nil {
-			return err
-		}
+	if file.FileInfo().IsDir() {
+		return mkdirAllBeneath(destination, filename)
 	}
 
-	writer, err := os.Create(filename)
+	writer, err := createFileBeneath(destination, filename, 0666)
 	if err != nil {
 		return err
 	}
 
-	_, _ = io.Copy(writer, fileToExtract)
+	defer func() {
+		if err := writer.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	_, err = io.Copy(limits.writer(file.Name, writer), newProgressReader(newContextReader(ctx, fileToExtract), onRead))
 
 	return err
 }
@@ -3,6 +3,7 @@ package onearchiver
 import (
 	"fmt"
 	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
@@ -140,6 +141,77 @@ func isSymlink(fi os.FileInfo) bool {
 	return fi.Mode()&os.ModeSymlink != 0
 }
 
+// creates a temp file next to [filename] so that it can be renamed over [filename] later on
+// the permissions of [filename] are carried over if it exists
+func createSiblingTempFile(filename string) (*os.File, error) {
+	tempFile, err := ioutil.TempFile(filepath.Dir(filename), fmt.Sprintf(".%s.*.tmp", filepath.Base(filename)))
+	if err != nil {
+		return nil, err
+	}
+
+	mode := os.FileMode(0644)
+	if fileInfo, err := os.Stat(filename); err == nil {
+		mode = fileInfo.Mode().Perm()
+	}
+
+	if err := tempFile.Chmod(mode); err != nil {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+
+		return nil, err
+	}
+
+	return tempFile, nil
+}
+
+// replaces [filename] with what [write] writes into a temp file next to it, once [write] succeeds
+// [filename] is left as it was on any error and the temp file is removed; [write] has to close the files open on [filename],
+// as it is replaced right after [write] returns
+func replaceViaTempFile(filename string, write func(out *os.File) error) error {
+	tempFile, err := createSiblingTempFile(filename)
+	if err != nil {
+		return err
+	}
+
+	tempFilename := tempFile.Name()
+
+	// a no-op once the temp file is renamed
+	defer func() {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFilename)
+	}()
+
+	if err := write(tempFile); err != nil {
+		return err
+	}
+
+	if err := syncAndClose(tempFile); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFilename, filename)
+}
+
+// checks whether [path] lies inside the directory [parent]; both the paths are cleaned and compared lexically
+func isPathWithin(parent string, path string) bool {
+	absParent, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(absParent, absPath)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, fmt.Sprintf("..%s", PathSep))
+}
+
 func Percent(partial float32, total float32) float32 {
 	return (partial / total) * 100
 }
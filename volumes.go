@@ -0,0 +1,544 @@
+package onearchiver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the output of a new archive; [io.Closer] puts it in place of the existing archive, [abort] throws it away
+type packingOutput interface {
+	io.WriteCloser
+
+	abort()
+}
+
+// writes the archive into a temp file next to [filename], which is synced and renamed over [filename] on close
+// the existing archive is left as it is until then
+type atomicFile struct {
+	*os.File
+
+	filename string
+}
+
+func createAtomicFile(filename string) (*atomicFile, error) {
+	tempFile, err := createSiblingTempFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &atomicFile{File: tempFile, filename: filename}, nil
+}
+
+// the volumes of an earlier split packing of [filename] are moved aside before the rename and removed after it,
+// as they would otherwise be picked up while reading the new archive; they are moved back if the rename fails
+func (af *atomicFile) Close() error {
+	if err := syncAndClose(af.File); err != nil {
+		_ = os.Remove(af.Name())
+
+		return err
+	}
+
+	movedVolumes, err := moveFilesAside(existingArchiveVolumes(af.filename))
+	if err != nil {
+		_ = os.Remove(af.Name())
+
+		return err
+	}
+
+	if err := os.Rename(af.Name(), af.filename); err != nil {
+		restoreMovedFiles(movedVolumes)
+		_ = os.Remove(af.Name())
+
+		return err
+	}
+
+	removeMovedFiles(movedVolumes)
+
+	return nil
+}
+
+func (af *atomicFile) abort() {
+	_ = af.File.Close()
+	_ = os.Remove(af.Name())
+}
+
+// flushes [file] to the disk before closing it, so that a crash right after the rename doesn't leave an empty archive behind
+func syncAndClose(file *os.File) error {
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
+
+// writes the archive into volumes of [volumeSize] bytes each, named by [volumeName] once the number of the volumes is known
+// every volume is written into a temp file, and they are all renamed in place on close; see [volumeWriter.Close]
+type volumeWriter struct {
+	filename   string
+	volumeSize int64
+	volumeName func(index int, count int) string
+	current    *os.File
+	written    int64
+	tempFiles  []string
+}
+
+// the volumes are named [filename].001, [filename].002..
+func newVolumeWriter(filename string, volumeSize int64) *volumeWriter {
+	return &volumeWriter{
+		filename:   filename,
+		volumeSize: volumeSize,
+		volumeName: func(index int, count int) string {
+			return volumeFilename(filename, index)
+		},
+	}
+}
+
+// the volumes are named [name].z01, [name].z02.. and the last one [filename]; see [zipVolumeFilename]
+func newZipVolumeWriter(filename string, volumeSize int64) *volumeWriter {
+	return &volumeWriter{
+		filename:   filename,
+		volumeSize: volumeSize,
+		volumeName: func(index int, count int) string {
+			if index == count {
+				return filename
+			}
+
+			return zipVolumeFilename(filename, index)
+		},
+	}
+}
+
+func (vw *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+
+	for len(p) > 0 {
+		if vw.current == nil || vw.written >= vw.volumeSize {
+			if err := vw.nextVolume(); err != nil {
+				return total, err
+			}
+		}
+
+		chunk := p
+		if remaining := vw.volumeSize - vw.written; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		n, err := vw.current.Write(chunk)
+		total += n
+		vw.written += int64(n)
+
+		if err != nil {
+			return total, err
+		}
+
+		p = p[n:]
+	}
+
+	return total, nil
+}
+
+// starts a new volume unless the current one has [n] bytes left, so that the next [n] bytes aren't split across two volumes
+func (vw *volumeWriter) reserve(n int64) error {
+	if n > vw.volumeSize {
+		return fmt.Errorf("the volume size is too small: %d", vw.volumeSize)
+	}
+
+	if vw.current != nil && vw.volumeSize-vw.written >= n {
+		return nil
+	}
+
+	return vw.nextVolume()
+}
+
+func (vw *volumeWriter) nextVolume() error {
+	if vw.current != nil {
+		if err := syncAndClose(vw.current); err != nil {
+			vw.current = nil
+
+			return err
+		}
+
+		vw.current = nil
+	}
+
+	file, err := createSiblingTempFile(vw.filename)
+	if err != nil {
+		return err
+	}
+
+	vw.current = file
+	vw.written = 0
+	vw.tempFiles = append(vw.tempFiles, file.Name())
+
+	return nil
+}
+
+// closes the last volume and puts the volumes in place of the copies of an earlier packing of [filename]: its volumes and [filename] itself
+// the earlier copies are moved aside first and moved back if any of the new volumes can't be renamed in place,
+// so that a failed packing leaves them as they were; they are removed once all the new volumes are in place
+// a crash midway can still leave a mix of the two sets behind, along with the earlier copies in their temp files
+func (vw *volumeWriter) Close() error {
+	if vw.current == nil {
+		if err := vw.nextVolume(); err != nil {
+			vw.abort()
+
+			return err
+		}
+	}
+
+	err := syncAndClose(vw.current)
+	vw.current = nil
+
+	if err != nil {
+		vw.abort()
+
+		return err
+	}
+
+	movedFiles, err := moveFilesAside(append(existingArchiveVolumes(vw.filename), vw.filename))
+	if err != nil {
+		vw.abort()
+
+		return err
+	}
+
+	var volumes []string
+
+	for index, tempFile := range vw.tempFiles {
+		volume := vw.volumeName(index+1, len(vw.tempFiles))
+
+		if err := os.Rename(tempFile, volume); err != nil {
+			for _, volume := range volumes {
+				_ = os.Remove(volume)
+			}
+
+			restoreMovedFiles(movedFiles)
+			vw.abort()
+
+			return err
+		}
+
+		volumes = append(volumes, volume)
+	}
+
+	removeMovedFiles(movedFiles)
+
+	return nil
+}
+
+// removes the temp files of the volumes which are not renamed yet
+func (vw *volumeWriter) abort() {
+	if vw.current != nil {
+		_ = vw.current.Close()
+		vw.current = nil
+	}
+
+	for _, tempFile := range vw.tempFiles {
+		_ = os.Remove(tempFile)
+	}
+}
+
+// writes a zip file as a pkzip split set; see [newZipVolumeWriter] and [writeZipSplitSet]
+// the zip file is written into a temp file first, as its central directory is rewritten with the volume numbers
+// and the offsets within the volumes
+type zipSplitFile struct {
+	*os.File
+
+	filename   string
+	volumeSize int64
+}
+
+func createZipSplitFile(filename string, volumeSize int64) (*zipSplitFile, error) {
+	tempFile, err := createSiblingTempFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipSplitFile{File: tempFile, filename: filename, volumeSize: volumeSize}, nil
+}
+
+func (zf *zipSplitFile) Close() error {
+	defer zf.abort()
+
+	fileInfo, err := zf.Stat()
+	if err != nil {
+		return err
+	}
+
+	vw := newZipVolumeWriter(zf.filename, zf.volumeSize)
+
+	if err := writeZipSplitSet(zf.File, fileInfo.Size(), vw); err != nil {
+		vw.abort()
+
+		return err
+	}
+
+	return vw.Close()
+}
+
+func (zf *zipSplitFile) abort() {
+	_ = zf.File.Close()
+	_ = os.Remove(zf.Name())
+}
+
+// a file which is moved aside while the new archive is renamed in place
+type movedFile struct {
+	filename     string
+	tempFilename string
+}
+
+// moves the existing [filenames] into temp files next to them; the files are moved back if any of them can't be moved
+func moveFilesAside(filenames []string) ([]movedFile, error) {
+	var movedFiles []movedFile
+
+	for _, filename := range filenames {
+		if !FileExists(filename) {
+			continue
+		}
+
+		tempFile, err := createSiblingTempFile(filename)
+		if err != nil {
+			restoreMovedFiles(movedFiles)
+
+			return nil, err
+		}
+
+		_ = tempFile.Close()
+
+		if err := os.Rename(filename, tempFile.Name()); err != nil {
+			_ = os.Remove(tempFile.Name())
+			restoreMovedFiles(movedFiles)
+
+			return nil, err
+		}
+
+		movedFiles = append(movedFiles, movedFile{filename: filename, tempFilename: tempFile.Name()})
+	}
+
+	return movedFiles, nil
+}
+
+// moves the files moved aside by [moveFilesAside] back in place
+func restoreMovedFiles(movedFiles []movedFile) {
+	for _, movedFile := range movedFiles {
+		if err := os.Rename(movedFile.tempFilename, movedFile.filename); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
+
+// removes the files moved aside by [moveFilesAside] once the new archive is in place
+// the new archive is complete by then, hence a file which can't be removed is only logged
+func removeMovedFiles(movedFiles []movedFile) {
+	for _, movedFile := range movedFiles {
+		if err := os.Remove(movedFile.tempFilename); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
+
+// returns the volumes of the earlier split packings of [filename] which are on the disk;
+// [filename].001, [filename].002.. and, for a zip file, the [name].z01, [name].z02.. volumes of a split set
+func existingArchiveVolumes(filename string) []string {
+	var volumes []string
+
+	for index := 1; FileExists(volumeFilename(filename, index)); index++ {
+		volumes = append(volumes, volumeFilename(filename, index))
+	}
+
+	if filepath.Ext(filename) == ".zip" {
+		for index := 1; FileExists(zipVolumeFilename(filename, index)); index++ {
+			volumes = append(volumes, zipVolumeFilename(filename, index))
+		}
+	}
+
+	return volumes
+}
+
+// returns the filename of the [index]th (1-based) volume of [filename]
+func volumeFilename(filename string, index int) string {
+	return fmt.Sprintf("%s.%03d", filename, index)
+}
+
+// returns the filename of the [index]th (1-based) volume of the zip split set [filename], e.g. archive.z01 for archive.zip;
+// the last volume is [filename] itself
+func zipVolumeFilename(filename string, index int) string {
+	return fmt.Sprintf("%s.z%02d", strings.TrimSuffix(filename, filepath.Ext(filename)), index)
+}
+
+// returns the volumes of the archive [filename] along with the name of the whole archive; nil is returned if the archive is not split
+// [filename] is either a volume ([name].001, [name].002..) or the name of the whole archive; the latter is joined from its volumes
+// only if there is no such file, so that the stray volumes next to a regular archive are left alone
+// the volume set is refused unless its volumes are numbered from 1 without a gap, and all but the last one are of the same size
+func archiveVolumes(filename string) (string, []string, error) {
+	if isZipVolumeFilename(filename) || (filepath.Ext(filename) == ".zip" && FileExists(filename)) {
+		return zipSplitSetVolumes(filename)
+	}
+
+	archiveFilename := filename
+
+	if isVolumeFilename(filename) {
+		archiveFilename = strings.TrimSuffix(filename, filepath.Ext(filename))
+	} else if FileExists(filename) || !FileExists(volumeFilename(filename, 1)) {
+		return filename, nil, nil
+	}
+
+	var volumes []string
+	var sizes []int64
+
+	for index := 1; ; index++ {
+		volume := volumeFilename(archiveFilename, index)
+
+		fileInfo, err := os.Stat(volume)
+		if os.IsNotExist(err) {
+			// a gap in the numbering means a missing volume rather than the end of the set
+			if FileExists(volumeFilename(archiveFilename, index+1)) {
+				return archiveFilename, nil, fmt.Errorf("a volume of the archive is missing: %s", volume)
+			}
+
+			break
+		}
+
+		if err != nil {
+			return archiveFilename, nil, err
+		}
+
+		volumes = append(volumes, volume)
+		sizes = append(sizes, fileInfo.Size())
+	}
+
+	if len(volumes) < 1 {
+		return archiveFilename, nil, fmt.Errorf("a volume of the archive is missing: %s", volumeFilename(archiveFilename, 1))
+	}
+
+	if !isVolumeInSet(filename, volumes) {
+		return archiveFilename, nil, fmt.Errorf("the volume is not part of a complete set: %s", filename)
+	}
+
+	for index, size := range sizes {
+		isLast := index == len(sizes)-1
+
+		if size < 1 || size > sizes[0] || (!isLast && size != sizes[0]) {
+			return archiveFilename, nil, fmt.Errorf("the volumes of the archive are inconsistent: %s", volumes[index])
+		}
+	}
+
+	return archiveFilename, volumes, nil
+}
+
+// returns the volumes of the zip split set which [filename] belongs to, along with the name of its last volume (the .zip file);
+// nil is returned if [filename] is a regular zip file
+// the number of the volumes is taken from the last volume, hence the stray .z01.. files next to a regular zip file are left alone
+func zipSplitSetVolumes(filename string) (string, []string, error) {
+	archiveFilename := filename
+	if isZipVolumeFilename(filename) {
+		archiveFilename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".zip"
+	}
+
+	if !FileExists(archiveFilename) {
+		return archiveFilename, nil, fmt.Errorf("a volume of the archive is missing: %s", archiveFilename)
+	}
+
+	count, err := zipSplitSetVolumeCount(archiveFilename)
+
+	// a broken zip file is left to the zip reader to report
+	if err != nil && archiveFilename == filename {
+		return filename, nil, nil
+	}
+
+	if err != nil {
+		return archiveFilename, nil, err
+	}
+
+	if count < 2 {
+		if archiveFilename == filename {
+			return filename, nil, nil
+		}
+
+		return archiveFilename, nil, fmt.Errorf("the volume is not part of a complete set: %s", filename)
+	}
+
+	var volumes []string
+
+	for index := 1; index < count; index++ {
+		volume := zipVolumeFilename(archiveFilename, index)
+
+		if !FileExists(volume) {
+			return archiveFilename, nil, fmt.Errorf("a volume of the archive is missing: %s", volume)
+		}
+
+		volumes = append(volumes, volume)
+	}
+
+	volumes = append(volumes, archiveFilename)
+
+	if !isVolumeInSet(filename, volumes) {
+		return archiveFilename, nil, fmt.Errorf("the volume is not part of a complete set: %s", filename)
+	}
+
+	return archiveFilename, volumes, nil
+}
+
+// checks whether the extension of [filename] is a volume number, e.g. .001
+func isVolumeFilename(filename string) bool {
+	ext := filepath.Ext(filename)
+	if len(ext) != 4 {
+		return false
+	}
+
+	for _, c := range ext[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checks whether the extension of [filename] is the volume number of a zip split set, e.g. .z01
+func isZipVolumeFilename(filename string) bool {
+	ext := filepath.Ext(filename)
+	if len(ext) < 4 || ext[1] != 'z' {
+		return false
+	}
+
+	for _, c := range ext[2:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isVolumeInSet(filename string, volumes []string) bool {
+	if !isVolumeFilename(filename) && !isZipVolumeFilename(filename) {
+		return true
+	}
+
+	for _, volume := range volumes {
+		if volume == filename {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the output of the archive [filename]; split into volumes if [volumeSize] is set
+func createPackingOutput(filename string, volumeSize int64) (packingOutput, error) {
+	if volumeSize > 0 && filepath.Ext(filename) == ".zip" {
+		return createZipSplitFile(filename, volumeSize)
+	}
+
+	if volumeSize > 0 {
+		return newVolumeWriter(filename, volumeSize), nil
+	}
+
+	return createAtomicFile(filename)
+}
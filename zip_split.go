@@ -0,0 +1,616 @@
+package onearchiver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// pkzip split sets (APPNOTE 8.5) record the volume (the "disk") which every local header and the central directory start on,
+// along with their offsets within that volume; the first volume starts with [zipSplitSignature]
+// the zip files are written and read as a single stream, hence only the central directory and the end records are rewritten
+
+var errInvalidZipFile = fmt.Errorf("zip: not a valid zip file")
+
+const (
+	zipEndLen           = 22
+	zip64EndLen         = 56
+	zip64LocatorLen     = 20
+	zipCentralHeaderLen = 46
+
+	// largest comment of the end of central directory record
+	maxZipCommentLen = 0xffff
+)
+
+// the end records of a zip file along with the fields which locate its central directory
+type zipEndRecords struct {
+	// offset of the first end record and the records up to the end of the file
+	offset int64
+	data   []byte
+
+	// offsets of the records within [data]; -1 if the zip64 records are missing
+	end     int
+	zip64   int
+	locator int
+
+	cdDisk   uint32
+	cdOffset uint64
+	cdSize   uint64
+}
+
+// reads the end records of the zip file [r]; [volumeOffsets] is the offset of every volume within [r], nil for a single volume
+func readZipEndRecords(r io.ReaderAt, size int64, volumeOffsets []int64) (*zipEndRecords, error) {
+	endOffset, err := findZipEnd(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	end := make([]byte, zipEndLen)
+	if _, err := r.ReadAt(end, endOffset); err != nil {
+		return nil, err
+	}
+
+	records := &zipEndRecords{
+		offset:   endOffset,
+		zip64:    -1,
+		locator:  -1,
+		cdDisk:   uint32(binary.LittleEndian.Uint16(end[6:])),
+		cdSize:   uint64(binary.LittleEndian.Uint32(end[12:])),
+		cdOffset: uint64(binary.LittleEndian.Uint32(end[16:])),
+	}
+
+	locatorOffset := endOffset - zip64LocatorLen
+	locator := make([]byte, zip64LocatorLen)
+
+	if locatorOffset >= 0 {
+		if _, err := r.ReadAt(locator, locatorOffset); err != nil {
+			return nil, err
+		}
+	}
+
+	if locatorOffset >= 0 && binary.LittleEndian.Uint32(locator) == zip64LocatorSignature {
+		zip64Offset, err := volumeOffset(volumeOffsets, binary.LittleEndian.Uint32(locator[4:]), binary.LittleEndian.Uint64(locator[8:]))
+		if err != nil {
+			return nil, err
+		}
+
+		zip64 := make([]byte, zip64EndLen)
+		if zip64Offset+zip64EndLen > locatorOffset {
+			return nil, errInvalidZipFile
+		}
+
+		if _, err := r.ReadAt(zip64, zip64Offset); err != nil {
+			return nil, err
+		}
+
+		if binary.LittleEndian.Uint32(zip64) != zip64EndSignature {
+			return nil, errInvalidZipFile
+		}
+
+		records.offset = zip64Offset
+		records.cdDisk = binary.LittleEndian.Uint32(zip64[20:])
+		records.cdSize = binary.LittleEndian.Uint64(zip64[40:])
+		records.cdOffset = binary.LittleEndian.Uint64(zip64[48:])
+	}
+
+	records.data = make([]byte, size-records.offset)
+	if _, err := r.ReadAt(records.data, records.offset); err != nil {
+		return nil, err
+	}
+
+	records.end = int(endOffset - records.offset)
+
+	if records.offset != endOffset {
+		records.zip64 = 0
+		records.locator = int(locatorOffset - records.offset)
+	}
+
+	return records, nil
+}
+
+// returns the offset of the end of central directory record; it's followed by the archive comment only
+func findZipEnd(r io.ReaderAt, size int64) (int64, error) {
+	tailSize := int64(zipEndLen + maxZipCommentLen)
+	if tailSize > size {
+		tailSize = size
+	}
+
+	tail := make([]byte, tailSize)
+	if _, err := r.ReadAt(tail, size-tailSize); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	for i := len(tail) - zipEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) != zipEndSignature {
+			continue
+		}
+
+		if i+zipEndLen+int(binary.LittleEndian.Uint16(tail[i+20:])) <= len(tail) {
+			return size - tailSize + int64(i), nil
+		}
+	}
+
+	return 0, errInvalidZipFile
+}
+
+// returns the offset of [offset] of the volume [disk] within the volumes which start at [volumeOffsets]
+func volumeOffset(volumeOffsets []int64, disk uint32, offset uint64) (int64, error) {
+	if volumeOffsets == nil && disk == 0 {
+		return int64(offset), nil
+	}
+
+	if int(disk) >= len(volumeOffsets) {
+		return 0, fmt.Errorf("zip: the volume is missing: %d", disk+1)
+	}
+
+	return volumeOffsets[disk] + int64(offset), nil
+}
+
+// returns the number of the volumes recorded in the end records of the zip file [filename], 1 for a regular zip file
+func zipSplitSetVolumeCount(filename string) (int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	endOffset, err := findZipEnd(file, fileInfo.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	end := make([]byte, zipEndLen)
+	if _, err := file.ReadAt(end, endOffset); err != nil {
+		return 0, err
+	}
+
+	disk := binary.LittleEndian.Uint16(end[4:])
+	if disk != 0xffff || endOffset < zip64LocatorLen {
+		return int(disk) + 1, nil
+	}
+
+	// the volume number is taken from the zip64 locator
+	locator := make([]byte, zip64LocatorLen)
+	if _, err := file.ReadAt(locator, endOffset-zip64LocatorLen); err != nil {
+		return 0, err
+	}
+
+	if binary.LittleEndian.Uint32(locator) != zip64LocatorSignature {
+		return 0, errInvalidZipFile
+	}
+
+	return int(binary.LittleEndian.Uint32(locator[16:])), nil
+}
+
+// an entry of the central directory along with the fields which locate its local header
+type zipCentralEntry struct {
+	header []byte
+
+	disk           uint32
+	offset         uint64
+	compressedSize uint64
+
+	// the fields of [header] which hold [disk] and [offset]; either the ones of the header or the ones of its zip64 extra field
+	diskField   []byte
+	offsetField []byte
+}
+
+// splits the central directory [cd] into its entries
+func parseZipCentralDirectory(cd []byte) ([]zipCentralEntry, error) {
+	var entries []zipCentralEntry
+
+	for pos := 0; pos < len(cd); {
+		if len(cd)-pos < zipCentralHeaderLen || binary.LittleEndian.Uint32(cd[pos:]) != zipCentralHeaderSignature {
+			return nil, errInvalidZipFile
+		}
+
+		nameLen := int(binary.LittleEndian.Uint16(cd[pos+28:]))
+		extraLen := int(binary.LittleEndian.Uint16(cd[pos+30:]))
+		commentLen := int(binary.LittleEndian.Uint16(cd[pos+32:]))
+
+		next := pos + zipCentralHeaderLen + nameLen + extraLen + commentLen
+		if next > len(cd) {
+			return nil, errInvalidZipFile
+		}
+
+		header := cd[pos:next]
+
+		entry := zipCentralEntry{
+			header:         header,
+			disk:           uint32(binary.LittleEndian.Uint16(header[34:])),
+			offset:         uint64(binary.LittleEndian.Uint32(header[42:])),
+			compressedSize: uint64(binary.LittleEndian.Uint32(header[20:])),
+			diskField:      header[34:36],
+			offsetField:    header[42:46],
+		}
+
+		extra := header[zipCentralHeaderLen+nameLen : zipCentralHeaderLen+nameLen+extraLen]
+
+		if err := entry.readZip64Fields(extra); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+		pos = next
+	}
+
+	return entries, nil
+}
+
+// takes the fields which are set to 0xffff.. in the header from the zip64 extra field, which holds them in their order
+func (entry *zipCentralEntry) readZip64Fields(extra []byte) error {
+	header := entry.header
+
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+
+		if size > len(extra)-4 {
+			return errInvalidZipFile
+		}
+
+		if id != 0x0001 {
+			extra = extra[4+size:]
+
+			continue
+		}
+
+		field := extra[4 : 4+size]
+
+		next := func(n int) ([]byte, error) {
+			if len(field) < n {
+				return nil, errInvalidZipFile
+			}
+
+			value := field[:n]
+			field = field[n:]
+
+			return value, nil
+		}
+
+		// the uncompressed size comes first
+		if binary.LittleEndian.Uint32(header[24:]) == 0xffffffff {
+			if _, err := next(8); err != nil {
+				return err
+			}
+		}
+
+		if binary.LittleEndian.Uint32(header[20:]) == 0xffffffff {
+			value, err := next(8)
+			if err != nil {
+				return err
+			}
+
+			entry.compressedSize = binary.LittleEndian.Uint64(value)
+		}
+
+		if binary.LittleEndian.Uint32(header[42:]) == 0xffffffff {
+			value, err := next(8)
+			if err != nil {
+				return err
+			}
+
+			entry.offset = binary.LittleEndian.Uint64(value)
+			entry.offsetField = value
+		}
+
+		if binary.LittleEndian.Uint16(header[34:]) == 0xffff {
+			value, err := next(4)
+			if err != nil {
+				return err
+			}
+
+			entry.disk = binary.LittleEndian.Uint32(value)
+			entry.diskField = value
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// moves the local header of the entry to [offset] of the volume [disk]
+func (entry *zipCentralEntry) relocate(disk uint32, offset uint64) error {
+	switch {
+	case len(entry.diskField) == 4:
+		binary.LittleEndian.PutUint32(entry.diskField, disk)
+
+	case disk < 0xffff:
+		binary.LittleEndian.PutUint16(entry.diskField, uint16(disk))
+
+	default:
+		return fmt.Errorf("zip: too many volumes")
+	}
+
+	switch {
+	case len(entry.offsetField) == 8:
+		binary.LittleEndian.PutUint64(entry.offsetField, offset)
+
+	case offset < 0xffffffff:
+		binary.LittleEndian.PutUint32(entry.offsetField, uint32(offset))
+
+	default:
+		return fmt.Errorf("zip: the offset of an entry needs a zip64 extra field")
+	}
+
+	entry.disk = disk
+	entry.offset = offset
+
+	return nil
+}
+
+// writes the zip file [zipFile] into [vw] as a split set; a zip file which fits into a single volume is written as it is
+// only the file data is split wherever the volumes end; the local headers, the data descriptors, the entries of
+// the central directory and the end records are moved over to the next volume if they don't fit, same as info-zip
+func writeZipSplitSet(zipFile io.ReaderAt, size int64, vw *volumeWriter) error {
+	if size <= vw.volumeSize {
+		_, err := io.Copy(vw, io.NewSectionReader(zipFile, 0, size))
+
+		return err
+	}
+
+	records, err := readZipEndRecords(zipFile, size, nil)
+	if err != nil {
+		return err
+	}
+
+	if records.cdOffset+records.cdSize > uint64(records.offset) {
+		return errInvalidZipFile
+	}
+
+	cd := make([]byte, records.cdSize)
+	if _, err := zipFile.ReadAt(cd, int64(records.cdOffset)); err != nil {
+		return err
+	}
+
+	entries, err := parseZipCentralDirectory(cd)
+	if err != nil {
+		return err
+	}
+
+	// the position of the next byte written; only valid right after [volumeWriter.reserve]
+	position := func() (uint32, uint64) {
+		return uint32(len(vw.tempFiles) - 1), uint64(vw.written)
+	}
+
+	copied := int64(0)
+
+	// copies the zip file up to [end]; [whole] keeps the bytes in a single volume
+	copyUntil := func(end int64, whole bool) error {
+		if end < copied || end > int64(records.cdOffset) {
+			return errInvalidZipFile
+		}
+
+		if whole {
+			if err := vw.reserve(end - copied); err != nil {
+				return err
+			}
+		}
+
+		if _, err := io.Copy(vw, io.NewSectionReader(zipFile, copied, end-copied)); err != nil {
+			return err
+		}
+
+		copied = end
+
+		return nil
+	}
+
+	signature := make([]byte, 4)
+	binary.LittleEndian.PutUint32(signature, zipSplitSignature)
+
+	if _, err := vw.Write(signature); err != nil {
+		return err
+	}
+
+	// the entries in the order of their local headers
+	sortedEntries := make([]*zipCentralEntry, len(entries))
+	for i := range entries {
+		sortedEntries[i] = &entries[i]
+	}
+
+	sort.Slice(sortedEntries, func(i, j int) bool {
+		return sortedEntries[i].offset < sortedEntries[j].offset
+	})
+
+	localHeader := make([]byte, 30)
+
+	for _, entry := range sortedEntries {
+		offset := int64(entry.offset)
+
+		// the data descriptor of the previous entry, if any
+		if err := copyUntil(offset, true); err != nil {
+			return err
+		}
+
+		if _, err := zipFile.ReadAt(localHeader, offset); err != nil {
+			return err
+		}
+
+		headerLen := int64(len(localHeader)) + int64(binary.LittleEndian.Uint16(localHeader[26:])) + int64(binary.LittleEndian.Uint16(localHeader[28:]))
+
+		// the header is kept along with the first byte of the data, as some
+		// readers don't expect the data to start at the beginning of a volume
+		leading := headerLen
+		if entry.compressedSize > 0 {
+			leading += 1
+		}
+
+		if err := vw.reserve(leading); err != nil {
+			return err
+		}
+
+		if err := entry.relocate(position()); err != nil {
+			return err
+		}
+
+		if err := copyUntil(offset+headerLen, true); err != nil {
+			return err
+		}
+
+		if err := copyUntil(offset+headerLen+int64(entry.compressedSize), false); err != nil {
+			return err
+		}
+	}
+
+	if err := copyUntil(int64(records.cdOffset), true); err != nil {
+		return err
+	}
+
+	var cdDisk uint32
+	var cdOffset uint64
+
+	// volume of every entry of the central directory
+	var entryDisks []uint32
+
+	for i, entry := range entries {
+		if err := vw.reserve(int64(len(entry.header))); err != nil {
+			return err
+		}
+
+		disk, offset := position()
+		if i == 0 {
+			cdDisk, cdOffset = disk, offset
+		}
+
+		entryDisks = append(entryDisks, disk)
+
+		if _, err := vw.Write(entry.header); err != nil {
+			return err
+		}
+	}
+
+	end := records.data
+	if err := vw.reserve(int64(len(end))); err != nil {
+		return err
+	}
+
+	lastDisk, endOffset := position()
+	if lastDisk >= 0xffff {
+		return fmt.Errorf("zip: too many volumes")
+	}
+
+	if len(entries) < 1 {
+		cdDisk, cdOffset = lastDisk, endOffset
+	}
+
+	entriesOnLastDisk := 0
+	for _, disk := range entryDisks {
+		if disk == lastDisk {
+			entriesOnLastDisk += 1
+		}
+	}
+
+	if records.zip64 >= 0 {
+		zip64 := end[records.zip64:]
+		binary.LittleEndian.PutUint32(zip64[16:], lastDisk)
+		binary.LittleEndian.PutUint32(zip64[20:], cdDisk)
+		binary.LittleEndian.PutUint64(zip64[24:], uint64(entriesOnLastDisk))
+		binary.LittleEndian.PutUint64(zip64[48:], cdOffset)
+
+		locator := end[records.locator:]
+		binary.LittleEndian.PutUint32(locator[4:], lastDisk)
+		binary.LittleEndian.PutUint64(locator[8:], endOffset)
+		binary.LittleEndian.PutUint32(locator[16:], lastDisk+1)
+	}
+
+	patchZipEnd(end[records.end:], lastDisk, cdDisk, uint64(entriesOnLastDisk), cdOffset)
+
+	_, err = vw.Write(end)
+
+	return err
+}
+
+// sets the volume numbers, the number of the entries on the last volume and the offset of the central directory
+// of the end of central directory record [end]; the fields which are left to the zip64 records are kept as they are
+func patchZipEnd(end []byte, disk uint32, cdDisk uint32, entries uint64, cdOffset uint64) {
+	put16 := func(field []byte, value uint64) {
+		if binary.LittleEndian.Uint16(field) != 0xffff {
+			binary.LittleEndian.PutUint16(field, uint16(value))
+		}
+	}
+
+	put16(end[4:], uint64(disk))
+	put16(end[6:], uint64(cdDisk))
+	put16(end[8:], entries)
+
+	if binary.LittleEndian.Uint32(end[16:]) != 0xffffffff {
+		binary.LittleEndian.PutUint32(end[16:], uint32(cdOffset))
+	}
+}
+
+// reads the zip split set as a regular zip file; the central directory and the end records are rewritten
+// with the offsets within the whole set and take the place of the ones on the disk, see [archiveSource.ReadAt]
+func (as *archiveSource) joinZipSplitSet() error {
+	records, err := readZipEndRecords(as, as.size, as.offsets)
+	if err != nil {
+		return err
+	}
+
+	cdOffset, err := volumeOffset(as.offsets, records.cdDisk, records.cdOffset)
+	if err != nil {
+		return err
+	}
+
+	if cdOffset < 0 || cdOffset+int64(records.cdSize) > records.offset {
+		return errInvalidZipFile
+	}
+
+	cd := make([]byte, records.offset-cdOffset)
+	if _, err := as.ReadAt(cd, cdOffset); err != nil {
+		return err
+	}
+
+	entries, err := parseZipCentralDirectory(cd[:records.cdSize])
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		offset, err := volumeOffset(as.offsets, entries[i].disk, entries[i].offset)
+		if err != nil {
+			return err
+		}
+
+		if err := entries[i].relocate(0, uint64(offset)); err != nil {
+			return err
+		}
+	}
+
+	end := records.data
+
+	if records.zip64 >= 0 {
+		zip64 := end[records.zip64:]
+		binary.LittleEndian.PutUint32(zip64[16:], 0)
+		binary.LittleEndian.PutUint32(zip64[20:], 0)
+		binary.LittleEndian.PutUint64(zip64[24:], binary.LittleEndian.Uint64(zip64[32:]))
+		binary.LittleEndian.PutUint64(zip64[48:], uint64(cdOffset))
+
+		locator := end[records.locator:]
+		binary.LittleEndian.PutUint32(locator[4:], 0)
+		binary.LittleEndian.PutUint64(locator[8:], uint64(records.offset))
+		binary.LittleEndian.PutUint32(locator[16:], 1)
+	} else if cdOffset >= 0xffffffff {
+		return fmt.Errorf("zip: the offset of the central directory needs a zip64 end record")
+	}
+
+	patchZipEnd(end[records.end:], 0, 0, uint64(len(entries)), uint64(cdOffset))
+
+	as.patch = append(cd, end...)
+	as.patchOffset = cdOffset
+
+	return nil
+}